@@ -1,77 +1,137 @@
 package main
 
 import (
-	"bufio"
-	"crypto"
-	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"log"
 	"os"
+
+	"github.com/tgmars/hangmango/app/protocol"
 )
 
+// serverRoots ... the bundled CA that server certificates must be issued by.
+var serverRoots = loadRootCA()
+
 func initialiseSigning() (x509.Certificate, []byte, *rsa.PublicKey) {
 	cert, certBytes := parseCert()
 	return cert, certBytes, cert.PublicKey.(*rsa.PublicKey)
 }
 
-// generateCert ... Provided a root certificate and its provided key, sign the struct of the x509 certificate
-// provided in the first argument. Function also writes out the certificate and private key object (containing priv and pub key)
-// from the to certPath and keyPath. The private key is to be used to sign messages from the server, and the certificate is
-// to be distributed with clients.
+// loadRootCA ... returns a pool containing the CA certificate bundled with the client.
+func loadRootCA() *x509.CertPool {
+	caPath := "./app/client/hangmango-ca.crt"
+
+	data, err := readPEMFile(caPath)
+	if err != nil {
+		log.Printf("- ERROR - No usable CA certificate at %s - Ensure the file is present and try again - %s", caPath, err)
+		os.Exit(1)
+	}
+	ca, err := x509.ParseCertificate(data.Bytes)
+	if err != nil {
+		log.Printf("- CRYPTO - Failed to unmarshal certificate object from %s bytes - %s", caPath, err)
+		os.Exit(1)
+	}
+	if !ca.IsCA {
+		log.Printf("- CRYPTO - %s is not a CA certificate", caPath)
+		os.Exit(1)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca)
+	return roots
+}
+
+// parseCert ... reads the server certificate bundled with the client and verifies that it
+// chains to the bundled CA. Its public key is used to verify messages from the server.
 func parseCert() (x509.Certificate, []byte) {
 	certPath := "./app/client/hangmango.crt"
 
-	if !fileExists(certPath) {
-		log.Printf("- ERROR - No existing certificate at %s - Ensure the file is present and try again.", certPath)
+	data, err := readPEMFile(certPath)
+	if err != nil {
+		log.Printf("- ERROR - No usable certificate at %s - Ensure the file is present and try again - %s", certPath, err)
 		os.Exit(1)
-	} else {
-		// Certificate used for verification is already on disk, we'll use that to verify our messages from the server
-		certFile, err := os.Open(certPath)
-		if err != nil {
-			log.Printf("- CRYPTO - Expected to read from %s but failed to open handle - %s", certPath, err)
-			os.Exit(1)
-		}
-		pemfileinfo, _ := certFile.Stat()
-		var size int64 = pemfileinfo.Size()
-		pembytes := make([]byte, size)
-		buffer := bufio.NewReader(certFile)
-		_, err = buffer.Read(pembytes)
-		data, _ := pem.Decode([]byte(pembytes))
-		certFile.Close()
+	}
+	serverCert, err := x509.ParseCertificate(data.Bytes)
+	if err != nil {
+		log.Printf("- CRYPTO - Failed to unmarshal certificate object from %s bytes - %s", certPath, err)
+		os.Exit(1)
+	}
+	_, err = serverCert.Verify(x509.VerifyOptions{
+		Roots:     serverRoots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		log.Printf("- CRYPTO - %s was not issued by the bundled CA - %s", certPath, err)
+		os.Exit(1)
+	}
+	if _, ok := serverCert.PublicKey.(*rsa.PublicKey); !ok {
+		log.Printf("- CRYPTO - %s doesn't contain an RSA public key", certPath)
+		os.Exit(1)
+	}
+	return *serverCert, data.Bytes
+}
 
-		serverCert, err := x509.ParseCertificate(data.Bytes)
+// verifyServerHostname ... checks that the bundled server certificate was issued for host, the
+// address the client is about to dial, so a certificate for one server can't be used to
+// impersonate it at another address.
+func verifyServerHostname(host string) error {
+	if err := serverCertificate.VerifyHostname(host); err != nil {
+		return fmt.Errorf("bundled server certificate is not valid for %s - %s", host, err)
+	}
+	return nil
+}
+
+// serverCertificateVerifier ... returns the callback the session uses to check a certificate
+// advertised by the server during the handshake, which happens when the server has rotated to
+// a key other than the one in the bundled certificate. The certificate is only trusted if it
+// chains to the bundled CA and is valid for host.
+func serverCertificateVerifier(host string) func([]byte) (*rsa.PublicKey, error) {
+	bundledKeyID := protocol.KeyID(serverCertificatePubkey)
+	return func(der []byte) (*rsa.PublicKey, error) {
+		cert, err := x509.ParseCertificate(der)
 		if err != nil {
-			log.Printf("- CRYPTO - Failed to unmarshal certificate object from %s bytes - %s", certPath, err)
-			os.Exit(1)
+			return nil, err
 		}
-		err = serverCert.VerifyHostname("127.0.0.1")
+		_, err = cert.Verify(x509.VerifyOptions{
+			Roots:     serverRoots,
+			DNSName:   host,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		})
 		if err != nil {
-			log.Printf("- CRYPTO - certificate failed to validate for hostname - %s", err)
+			return nil, err
+		}
+		publicKey, ok := cert.PublicKey.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("server certificate doesn't contain an RSA public key")
+		}
+		if keyID := protocol.KeyID(publicKey); keyID != bundledKeyID {
+			log.Printf("- CRYPTO - Server is using key %s rather than the bundled %s, its certificate was verified against the bundled CA.", keyID, bundledKeyID)
 		}
-		return *serverCert, data.Bytes
+		return publicKey, nil
 	}
-	return x509.Certificate{}, nil
 }
 
-func fileExists(filename string) bool {
-	info, err := os.Stat(filename)
-	if os.IsNotExist(err) {
-		return false
+// readPEMFile ... returns the first PEM block in the file at path.
+func readPEMFile(path string) (*pem.Block, error) {
+	pembytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pembytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
 	}
-	return !info.IsDir()
+	return block, nil
 }
 
-// Sign signs data with rsa-sha256
-func (enc *encryptedMessage) Sign(r *rsa.PrivateKey) {
-	hash := sha256.New()
-	hash.Write(enc.A)
-	hashed := hash.Sum(nil)
-	signature, err := rsa.SignPSS(rand.Reader, r, crypto.SHA256, hashed, nil)
-	if err != nil {
-		os.Exit(1)
+// newTLSConfig ... returns a TLS config that only trusts certificates issued by the
+// bundled CA, for use with the -tls flag.
+func newTLSConfig(serverName string) *tls.Config {
+	return &tls.Config{
+		RootCAs:    serverRoots,
+		ServerName: serverName,
+		MinVersion: tls.VersionTLS12,
 	}
-	enc.B = signature
 }
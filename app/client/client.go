@@ -3,86 +3,80 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"crypto"
+	"crypto/ecdh"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"os"
-	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tgmars/hangmango/app/protocol"
 )
 
 // client ... maintains the client's state and communications channels
 type client struct {
 	socket          net.Conn
 	data            chan []byte
+	codec           *protocol.Codec
+	session         *protocol.Session
+	ecdheKey        *ecdh.PrivateKey
+	certificate     *tls.Certificate
+	hello           protocol.Hello
 	guid            string
-	encrypted       bool
-	message         message
-	encmsg          encryptedMessage
-	symmetricKey    []byte
 	gameHash        []byte
+	gameStarted     chan struct{}
 	gameInitTime    []byte
 	gameHashMatched bool
+	// gameOver is signalled once GAME OVER has been handled and another round can be started.
+	gameOver chan struct{}
+	// gameMu guards guid, gameHash, gameHashMatched and gameStarted, which the receive
+	// goroutine replaces as games start and end while the input loop reads them.
+	gameMu sync.Mutex
+	// settings are sent with START GAME, nil leaves the game up to the server.
+	settings *protocol.GameSettings
+	// alphabet guesses are validated with before they're sent, the server's once the game has started.
+	alphabet protocol.Alphabet
+	// opponent is the last progress the server sent about our opponent in a race, nil until
+	// the race has started.
+	opponent *protocol.OpponentStatus
 }
 
-type message struct {
-	Mtype     string `json:",omitempty"`
-	Content   []byte `json:",omitempty"`
-	Hash      []byte `json:",omitempty"`
-	Signature []byte `json:",omitempty"`
-}
-
-// encryptedMessage ... Maintains two fields, A is the encrypted message and the other
-// is the MAC validation/signature field.
-type encryptedMessage struct {
-	A []byte `json:"A,omitempty"`
-	B []byte `json:"B,omitempty"`
-}
-
-// Regex pattern for basic client side validation of string prior to sending to server.
-var regexpHangman = regexp.MustCompile("[^a-zA-Z]+")
-
-// Regex pattern for basic client side validation of a string received from the server.
-var regexpValidServerMessage = regexp.MustCompile("^[a-zA-Z_0-9 ]{1,100}$")
-
-// Public key of the server, contains a RSA 2048 byte key once a PUBKEYRESP from the server is parsed.
-var serverPubKey rsa.PublicKey
-
 var serverCertificate, serverCertificateBytes, serverCertificatePubkey = initialiseSigning()
 
-// serverPrivKey and serverPubKey are RSA 2048 byte length keys
-var clientPrivKey, clientPubKey = initialiseEncryption()
+// clientPrivKey and clientPubKey are RSA 2048 byte length keys, only generated for the RSA handshake.
+var clientPrivKey rsa.PrivateKey
+var clientPubKey rsa.PublicKey
 
-// receive() ... Reads data off the clients socket into a 4096 byte array and prints,
-// formats them and prints to the user. This function is called
-// as a goroutine from main()
+// maxFrameSize ... largest frame that will be read from or written to the socket.
+var maxFrameSize uint32 = protocol.DefaultMaxFrameSize
+
+// receive() ... Reads length-prefixed frames off the clients socket and passes
+// each complete frame to receiveLogic() which formats and prints them to the user.
+// This function is called as a goroutine from main()
 func (client *client) receive() {
 	for {
-		message := make([]byte, 4096)
-		length, err := client.socket.Read(message)
+		frame, err := client.codec.ReadFrame()
 		if err != nil {
-			fmt.Printf("ERROR - Reading from socket - %s\n", err)
+			if _, ok := err.(*protocol.ProtocolError); ok {
+				fmt.Printf("ERROR - Server violated the hangmango protocol - %s\n", err)
+			} else {
+				fmt.Printf("ERROR - Reading from socket - %s\n", err)
+			}
 			client.socket.Close()
 			fmt.Println("CLIENT - Exiting hangmango client")
 			os.Exit(1)
-
-		}
-		if length > 0 {
-			// Multiple packets sent in rapid succession can fill the message buffer and get parsed
-			// in a single iteration of the go routine. Thus, we catch this case by
-			// splitting out the messages on newlines.
-			// sMessages := strings.Split(strings.TrimRight(string(message[:n]), "\n"), "\n")
-			// messages := bytes.Split(message, []byte("\n"))
-			// for _, msg := range messages {
-			receiveLogic(message, length, client)
-			// }
 		}
+		receiveLogic(frame, client)
 	}
 }
 
@@ -97,8 +91,7 @@ func (client *client) send() {
 			if !ok {
 				return
 			}
-			// message = append(message, '\n')
-			_, err := client.socket.Write(message)
+			err := client.codec.WriteFrame(message)
 			if err != nil {
 				fmt.Printf("ERROR - %s\n", err)
 				fmt.Println("CLIENT - Exiting hangmango client")
@@ -113,16 +106,83 @@ func (client *client) send() {
 // start the send and receive goroutines, send the client the START GAME
 // message and wait for user input.
 func main() {
-	flagDAddress := flag.String("dhost", "127.0.0.1", "Hangmango server IPv4 address to connect to.")
+	flagDAddress := flag.String("dhost", "127.0.0.1", "Hangmango server host name or IP address to connect to, which must be included in the server's certificate.")
 	flagDPort := flag.Int("dport", 4444, "Port that the target Hangmango server is listening on.")
+	flagHandshake := flag.String("handshake", "ecdhe", "Handshake used to establish the session key, either ecdhe (forward secret) or rsa.")
+	flagCert := flag.String("cert", "", "Path to a client certificate issued by the server's CA, used to authenticate to the server. (optional)")
+	flagKey := flag.String("key", "", "Path to the private key for -cert. (optional)")
+	flagTLS := flag.Bool("tls", false, "Connect over TLS, verifying the server against the bundled certificate, instead of the hangmango handshake.")
+	flagMaxFrame := flag.Uint("maxframe", protocol.DefaultMaxFrameSize, "Maximum size in bytes of a single protocol frame sent or received.")
+	flagDifficulty := flag.String("difficulty", "", "Game to ask the server for, easy, medium or hard, optionally followed by min=, max= or lives= to set the answer length or lives, for example hard,lives=6 or min=4,max=6. Left to the server when empty.")
+	flagRace := flag.Bool("race", false, "Race another player for the same word, the server pairs us with the next player asking for a race with the same -difficulty.")
 	flag.Parse()
+	if *flagMaxFrame == 0 || *flagMaxFrame > math.MaxUint32 {
+		fmt.Printf("ERROR - -maxframe must be between 1 and %d bytes\n", uint32(math.MaxUint32))
+		os.Exit(1)
+	}
+	maxFrameSize = uint32(*flagMaxFrame)
+	if *flagHandshake != "ecdhe" && *flagHandshake != "rsa" {
+		fmt.Println("ERROR - -handshake must be either ecdhe or rsa")
+		os.Exit(1)
+	}
+	var settings *protocol.GameSettings
+	if *flagDifficulty != "" {
+		parsed, err := protocol.ParseGameSettings(*flagDifficulty)
+		if err != nil {
+			fmt.Printf("ERROR - -difficulty - %s\n", err)
+			os.Exit(1)
+		}
+		settings = &parsed
+	}
+	if *flagRace {
+		if settings == nil {
+			settings = &protocol.GameSettings{}
+		}
+		settings.Race = true
+	}
+	var certificate *tls.Certificate
+	if *flagCert != "" || *flagKey != "" {
+		loaded, err := tls.LoadX509KeyPair(*flagCert, *flagKey)
+		if err != nil {
+			fmt.Printf("ERROR - Unable to load client certificate - %s\n", err)
+			os.Exit(1)
+		}
+		if _, ok := loaded.PrivateKey.(*rsa.PrivateKey); !ok {
+			fmt.Println("ERROR - Client certificate key must be an RSA key")
+			os.Exit(1)
+		}
+		certificate = &loaded
+	}
+	// Over TLS the hostname is verified against the certificate the server presents instead.
+	if !*flagTLS {
+		if err := verifyServerHostname(*flagDAddress); err != nil {
+			fmt.Printf("ERROR - %s\n", err)
+			fmt.Println("CLIENT - Exiting hangmango client")
+			os.Exit(1)
+		}
+	}
+	if *flagHandshake == "rsa" && !*flagTLS {
+		clientPrivKey, clientPubKey = initialiseEncryption()
+	}
 
 	fmt.Println(`STARTUP - Welcome to hangmango! You will be presented with hints to guess a word selected by the server. 
-	  You can enter guesses as individual english alphabet characters or an entire word. 
-	  Incorrect guesses will deduct from your score per the following forumla: 
-	  10 * (number of letters in secret word) - 2 * (number of characters guessed) - (number of words guessed)`)
-
-	conn, err := net.Dial("tcp", fmt.Sprintf("%s:%d", *flagDAddress, *flagDPort))
+	  You can enter guesses as individual letters or an entire word or phrase. 
+	  Guesses will deduct from your score, how depends on the scoring strategy the server uses,
+	  which is explained when the game is over. You can then play another round, and when
+	  you're done the server sums up every round played.`)
+
+	address := net.JoinHostPort(*flagDAddress, strconv.Itoa(*flagDPort))
+	var conn net.Conn
+	var err error
+	if *flagTLS {
+		config := newTLSConfig(*flagDAddress)
+		if certificate != nil {
+			config.Certificates = []tls.Certificate{*certificate}
+		}
+		conn, err = tls.Dial("tcp", address, config)
+	} else {
+		conn, err = net.Dial("tcp", address)
+	}
 	if err != nil {
 		exitString := `ERROR - Unable to connect to specified hangmango server, likely that it's not 
 		  running or a network device is preventing the connection. The raw error is below.`
@@ -132,222 +192,454 @@ func main() {
 	}
 
 	// Initialise the client struct that represents this client
-	client := &client{socket: conn, data: make(chan []byte), guid: fmt.Sprintf("%d", time.Now().Unix())}
+	client := &client{
+		socket: conn,
+		data:   make(chan []byte),
+		codec:  protocol.NewCodec(conn, maxFrameSize),
+		session: protocol.NewSession(protocol.SessionConfig{
+			LocalKey:          &clientPrivKey,
+			VerificationKey:   serverCertificatePubkey,
+			VerifyCertificate: serverCertificateVerifier(*flagDAddress),
+			SecureTransport:   *flagTLS,
+		}),
+		certificate: certificate,
+		gameStarted: make(chan struct{}),
+		gameOver:    make(chan struct{}, 1),
+		guid:        fmt.Sprintf("%d", time.Now().Unix()),
+		alphabet:    protocol.AlphabetEnglish,
+		settings:    settings,
+	}
+
+	// Offer the handshake chosen with -handshake, TLS replaces the handshake altogether.
+	client.hello = protocol.Hello{
+		Versions: protocol.SupportedVersions,
+		Features: []protocol.Feature{protocol.FeatureRekey, protocol.FeatureRounds, protocol.FeatureRace},
+	}
+	if !*flagTLS {
+		if *flagHandshake == "rsa" {
+			client.hello.Suites = []protocol.Suite{protocol.SuiteRSA}
+		} else {
+			client.hello.Suites = []protocol.Suite{protocol.SuiteECDHE}
+		}
+		if certificate != nil {
+			client.hello.Features = append(client.hello.Features, protocol.FeatureClientAuth)
+		}
+	}
 
 	go client.send()
 	go client.receive()
-	initPubKeyReq(client)
+	// The handshake begins once the server has replied to our HELLO.
+	client.sendMessage(protocol.Message{Mtype: protocol.KindHello, Hello: &client.hello, KeyID: protocol.KeyID(serverCertificatePubkey)})
+
+	// Guesses are bound to the game hash, so nothing is sent until the first hint has arrived with it.
+	<-client.started()
 
 	// Wait for user input and send anything that matches simple client side validation to the server.
+	reader := bufio.NewReader(os.Stdin)
 	for {
-		// Block until
-		reader := bufio.NewReader(os.Stdin)
-		message, _ := reader.ReadString('\n')
-		message = strings.TrimRight(message, "\n")
-		// Validate message is within the regex set.
-		match := regexpHangman.Match([]byte(message))
-		// Validate message is in the regex set & hasn't completely filled the buffer from ReadString (4096 bytes)
-		if !match && (len([]byte(message)) <= 4095) {
+		// Block until a full line has been entered, stdin closing ends the client.
+		message, err := reader.ReadString('\n')
+		if err != nil {
+			client.quit()
+		}
+		message = protocol.Normalize(strings.TrimRight(message, "\n"))
+		// Once a game is over the next line answers whether to play another round.
+		select {
+		case <-client.gameOver:
+			if answer := strings.ToLower(strings.TrimSpace(message)); answer == "y" || answer == "yes" {
+				client.newGame()
+			} else {
+				client.quit()
+			}
+			continue
+		default:
+		}
+		// Validate message only contains letters of the server's alphabet and separators.
+		invalid := client.alphabet.Check(message)
+		// Validate message is in the alphabet & hasn't completely filled the buffer from ReadString (4096 bytes)
+		if invalid == nil && (len([]byte(message)) <= 4095) {
 			// Use the message given what we've sent.
+			client.gameMu.Lock()
+			hint, gameHash := client.guid, client.gameHash
+			client.gameMu.Unlock()
 			var guessForHashing string
-			if len([]byte(message)) == 1 {
-				guessForHashing = strings.Replace(client.guid, "_", message, -1)
+			if utf8.RuneCountInString(message) == 1 {
+				guessForHashing = strings.Replace(hint, "_", strings.ToLower(message), -1)
 			} else {
-				guessForHashing = message
+				guessForHashing = phraseFromHint(hint, message)
 			}
 			// Calculate the gamehash given the message provided.
 			guessHash := client.generateGameHash([]byte(guessForHashing))
-			var messageJSON []byte
-			if bytes.Equal(guessHash, client.gameHash) {
-				messageJSON = generateHangmanJSONMessage([]byte(message), guessHash)
+			guess := protocol.Message{Content: []byte(message)}
+			if bytes.Equal(guessHash, gameHash) {
+				guess.Hash = guessHash
+				client.gameMu.Lock()
 				client.gameHashMatched = true
-			} else {
-				messageJSON = generateHangmanJSONMessage([]byte(message), nil)
+				client.gameMu.Unlock()
 			}
-			encryptJSONAddToChannel(client, messageJSON)
-		} else if match == true {
-			fmt.Println("Input must be an upper or lowercase character in the english alphabet (a-z or A-Z).")
+			client.sendMessage(guess)
+		} else if invalid != nil {
+			fmt.Printf("Input must be upper or lowercase letters of the %s alphabet (%s), phrases may also contain spaces, hyphens and apostrophes - %s.\n", client.alphabet.Name, client.alphabet.Letters, invalid)
 		} else if len([]byte(message)) >= 4096 {
 			fmt.Println("Length of input must be less than 4096 bytes.")
 		}
 	}
 }
 
+// initPubKeyReq ... provides our public key to the server in a PUBKEYREQ, beginning the handshake.
 func initPubKeyReq(client *client) {
-	// provide our public key
 	clientPubKeyBytes, err := json.Marshal(clientPubKey)
 	if err != nil {
 		log.Printf("- ENCODING - %s", err)
 	}
-	// fmt.Println(string(clientPubKeyBytes))
-	msg := message{Mtype: "PUBKEYREQ", Content: clientPubKeyBytes}
-	bmsg, err := json.Marshal(msg)
+	client.sendMessage(protocol.Message{Mtype: protocol.KindPubKeyReq, Content: clientPubKeyBytes, KeyID: protocol.KeyID(serverCertificatePubkey)})
+}
+
+// initECDHEReq ... provides an ephemeral X25519 key share to the server in an ECDHEREQ,
+// beginning a forward secret handshake.
+func initECDHEReq(client *client) {
+	ecdheKey, err := protocol.GenerateECDHEKey()
 	if err != nil {
-		log.Printf("- ENCODING - %s", err)
+		log.Printf("- CRYPTO - %s", err)
+		os.Exit(1)
 	}
-	encmsg := generateEncryptedMessage(bmsg, nil)
-	// fmt.Printf("%s\n", string(bmsg))
-	client.data <- encmsg
-	// Clear the message to nil
-	client.message = message{}
-
+	client.ecdheKey = ecdheKey
+	client.sendMessage(protocol.Message{Mtype: protocol.KindECDHEReq, Content: ecdheKey.PublicKey().Bytes(), KeyID: protocol.KeyID(serverCertificatePubkey)})
 }
 
-func receiveLogic(input []byte, length int, client *client) {
-	// Multiple packets sent in rapid succession can fill the message buffer and get parsed
-	// in a single iteration of the go rapidroutine. Thus, we catch this case by
-	// splitting out the messages on newlines.
-	input = input[:length]
-	// Only parse PUBKEYRESP messages if we don't have a server key currently stored.
-	// This implies that the message we'll receive won't be encrypted and can be treated as such.
+// receiveLogic ... handles a single frame received from the server.
+func receiveLogic(input []byte, client *client) {
+	// The session verifies the servers signature on handshake messages and decrypts
+	// everything else, any failure means we can no longer trust the connection.
+	message, err := client.session.Open(input)
+	if err != nil {
+		fmt.Printf("ERROR - Couldn't read a message from the server, %s - %s\n", protocol.ErrorCodeFor(err), err)
+		os.Exit(1)
+	}
+
+	// The server sends an ERROR with the reason it's closing the connection.
+	if message.Mtype == protocol.KindError {
+		fmt.Printf("ERROR - Server closed the connection - %s\n", message.Err())
+		os.Exit(1)
+	}
 
-	// log.Printf("- DEBUG - FROM - Client received: %s", input)
-	unMarshalMessage(input, client)
+	// The servers HELLO picks the version of the protocol the rest of the connection uses.
+	if message.Mtype == protocol.KindHello {
+		handleHello(client, message)
+		return
+	}
+	switch client.session.Version() {
+	case protocol.Version1:
+		receiveVersion1(client, message)
+	default:
+		fmt.Printf("ERROR - Server sent %s before HELLO\n", message.Mtype)
+		os.Exit(1)
+	}
+}
 
-	// now we can access client.message.fields to parse out the different cases
-	if client.message.Mtype == "PUBKEYRESP" {
-		handlePubKeyResp(client)
+// receiveVersion1 ... handles a message from a server that negotiated version 1 of the protocol.
+func receiveVersion1(client *client, message protocol.Message) {
+	// now we can access message fields to parse out the different cases
+	if message.Mtype == protocol.KindPubKeyResp {
+		handlePubKeyResp(client, message)
 	}
-	if client.message.Mtype == "SYMKEYRESP" {
-		handleSymKeyResp(client)
+	if message.Mtype == protocol.KindSymKeyResp {
+		handleSymKeyResp(client, message)
 	}
-	if client.message.Mtype == "GAME OVER" {
-		if client.gameHashMatched == false {
+	if message.Mtype == protocol.KindECDHEResp {
+		handleECDHEResp(client, message)
+	}
+	if message.Mtype == protocol.KindAlreadyGuessed {
+		fmt.Printf("You've already guessed %s, try again.\n", message.Content)
+		printStatus(message.Status)
+	}
+	if message.Mtype == protocol.KindRejected {
+		fmt.Printf("Guess rejected - %s\n", message.Err())
+	}
+	if message.Mtype == protocol.KindOpponent {
+		client.handleOpponent(message.Opponent)
+	}
+	if message.Mtype == protocol.KindSummary {
+		printSummary(message.Summary)
+		os.Exit(0)
+	}
+	if message.Mtype == protocol.KindGameOver {
+		client.gameMu.Lock()
+		gameHash, gameHashMatched := client.gameHash, client.gameHashMatched
+		client.gameMu.Unlock()
+		if message.Result != nil && (message.Result.Outcome == protocol.OutcomeLost || message.Result.Outcome == protocol.OutcomeBeaten) {
+			// The answer is revealed when we lose, it must be the word the game hash was made from.
+			if !bytes.Equal(client.generateGameHash([]byte(message.Result.Answer)), gameHash) {
+				fmt.Println("You lost, but the answer the server revealed doesn't match the game hash. The server was manipulated since you started your game.")
+				os.Exit(1)
+			}
+			if message.Result.Outcome == protocol.OutcomeBeaten {
+				fmt.Printf("Your opponent guessed it first, you lost! The word was %s. You scored: %s\n", message.Result.Answer, message.Content)
+			} else {
+				fmt.Printf("Out of lives, you lost! The word was %s. You scored: %s\n", message.Result.Answer, message.Content)
+			}
+			printRaceResult(message.Result.Race)
+			client.endRound(message.Result)
+			return
+		}
+		if gameHashMatched == false {
 			fmt.Println("You received a GAME OVER message from the server, but game hashes didn't match. The server was manipulated since you started your game.")
 			os.Exit(1)
 		} else {
-			fmt.Printf("Game over! You scored: %s\n", client.message.Content)
-			os.Exit(0)
+			fmt.Printf("Game over! You scored: %s\n", message.Content)
+			explainScore(message.Result)
+			if message.Result != nil {
+				printRaceResult(message.Result.Race)
+			}
+			client.endRound(message.Result)
 		}
 
 	}
 	// only hangmango application messages should meet this criteria.
-	if (client.message.Mtype == "") && (len(client.message.Content) > 0) {
+	if (message.Mtype == protocol.KindHangman) && (len(message.Content) > 0) {
+		client.gameMu.Lock()
+		defer client.gameMu.Unlock()
 		// Only parse a message with a hash parameter if we haven't had one previously that's
 		// been stored by the client (the client.gameHash has length 0)
-		if len(client.message.Hash) > 0 && len(client.gameHash) == 0 {
+		if len(message.Hash) > 0 && len(client.gameHash) == 0 {
 			// This logical route is receiving the initial game hint message after a 'START GAME'
 			// We store this time to be used as an input to calculating the gamehash that'll be compared
 			// to the one we've just received from the server
 			client.gameInitTime = getCurrentTimeMinutes()
-			client.gameHash = client.message.Hash
-			fmt.Println(string(client.message.Content))
-		} else if len(client.message.Hash) > 0 && len(client.gameHash) > 0 {
+			client.gameHash = message.Hash
+			client.session.SetGameHash(message.Hash)
+			client.guid = string(message.Content)
+			if message.Status != nil && message.Status.Alphabet != nil {
+				client.alphabet = *message.Status.Alphabet
+			}
+			client.opponent = nil
+			printSettings(message.Settings)
+			close(client.gameStarted)
+			printHint(message)
+		} else if len(message.Hash) > 0 && len(client.gameHash) > 0 {
 			fmt.Println("Server attempting to store a new gamehash and may have had its current answer modified!")
 		} else {
 			// temporaily store the hint we got in the guid field...
-			client.guid = string(client.message.Content)
-			fmt.Println(string(client.message.Content))
+			client.guid = string(message.Content)
+			printHint(message)
+			// In a race we're out of lives before the game is over, it ends when our opponent finishes.
+			if message.Status != nil && message.Status.MaxLives > 0 && message.Status.Lives == 0 {
+				fmt.Println("Out of lives, waiting for your opponent to finish...")
+			}
 		}
 	}
 }
 
-// Handle the message containing a servers public key and initiate
-// the game with them.
-func handlePubKeyResp(client *client) {
-	err := json.Unmarshal(client.message.Content, &serverPubKey)
-	if err != nil {
-		log.Printf("- ERROR - Deserialisation error - %s\n", err)
-	} else {
-		client.encrypted = true
-		msg := message{Mtype: "SYMKEYREQ"}
-		bmsg, err := json.Marshal(msg)
-		if err != nil {
-			log.Printf("- ENCODING - %s", err)
+// phraseFromHint ... returns the answer guess would be if correct, for hashing. The server
+// compares phrases by their letters alone, so the letters of guess are placed in the letter
+// positions of hint and the separators the hint revealed are kept. If guess has the wrong
+// number of letters it's returned lowercased, as it can't be the answer.
+func phraseFromHint(hint string, guess string) string {
+	var letters []rune
+	for _, r := range strings.ToLower(guess) {
+		if unicode.IsLetter(r) {
+			letters = append(letters, r)
 		}
-		encryptJSONAddToChannel(client, bmsg)
 	}
+	phrase := []rune(hint)
+	next := 0
+	for i, r := range phrase {
+		if protocol.IsSeparator(r) {
+			continue
+		}
+		if next == len(letters) {
+			return strings.ToLower(guess)
+		}
+		phrase[i] = letters[next]
+		next++
+	}
+	if next != len(letters) {
+		return strings.ToLower(guess)
+	}
+	return string(phrase)
 }
 
-// handleSymKeyResp ... Handle the message containing a symmetric key
-// and initiate gameplay with encryptedMessage{}s
-func handleSymKeyResp(client *client) {
-	client.symmetricKey = client.message.Content
+// scoringDescriptions ... explains the scoring strategies a server may name in GAME OVER.
+var scoringDescriptions = map[string]string{
+	"original": "10 * (number of letters in secret word) - 2 * (number of characters guessed) - (number of words guessed)",
+	"misses":   "10 * (number of letters in secret word) - 2 * (number of wrong characters) - (number of wrong words)",
+	"timed":    "10 * (number of letters in secret word) - 2 * (number of wrong characters) - (number of wrong words) - (seconds taken / 10)",
+	"rarity":   "5 * (Scrabble value of each letter in secret word) - 2 * (number of wrong characters) - (number of wrong words)",
+}
 
-	// Now encrypt using symmetric key
-	msg := message{Content: []byte("START GAME")}
-	bmsg, err := json.Marshal(msg)
-	if err != nil {
-		log.Printf("- ENCODING - %s", err)
+// explainScore ... prints how the score in a GAME OVER was calculated.
+func explainScore(result *protocol.GameResult) {
+	if result == nil || result.Scoring == "" {
+		return
+	}
+	if description, ok := scoringDescriptions[result.Scoring]; ok {
+		fmt.Printf("Scored with the %s strategy: %s\n", result.Scoring, description)
+	} else {
+		fmt.Printf("Scored with the %s strategy.\n", result.Scoring)
 	}
-	encryptJSONAddToChannel(client, bmsg)
 }
 
-// unMarshalMessage is responsible for parsing encryptedMessage structs,
-// verifying hashes to ensure sender identity and unmarshalling data back
-// into message structs.
-func unMarshalMessage(message []byte, client *client) {
-	// Unmarshal our message into an encmsg struct
-	err := json.Unmarshal(message, &client.encmsg)
-	if err != nil {
-		log.Printf("- ERROR - Deserialisation error occured for incoming encryptedMessage - %s\n", err)
-	}
-	// If data was encrypted using pubkey encryption; Verify the signature of the message
-	if len(client.symmetricKey) == 0 {
-		hash := sha256.New()
-		hash.Write(client.encmsg.A)
-		encmsgAHashed := hash.Sum(nil)
-		err = rsa.VerifyPSS(serverCertificatePubkey, crypto.SHA256, encmsgAHashed, client.encmsg.B, nil)
-		if err != nil {
-			log.Printf("- ERROR - Failed to verify message signature - %s\n", err)
-			os.Exit(1)
-		}
+// printSettings ... prints the settings the server chose for the game, if we asked for any.
+func printSettings(settings *protocol.GameSettings) {
+	if settings == nil {
+		return
 	}
-
-	var plaintext []byte
-	if client.encrypted == true && len(client.symmetricKey) == 0 {
-		plaintext = decrypt(client.encmsg.A, clientPrivKey)
-	} else if client.encrypted == true && len(client.symmetricKey) > 0 {
-		plaintext = decryptAEADGCM(client.symmetricKey, client.encmsg.A, client.encmsg.B)
+	var parts []string
+	if settings.Difficulty != "" {
+		parts = append(parts, fmt.Sprintf("%s difficulty", settings.Difficulty))
+	}
+	if settings.MaxLength > 0 {
+		parts = append(parts, fmt.Sprintf("%d to %d letters", max(1, settings.MinLength), settings.MaxLength))
 	} else {
-		plaintext = client.encmsg.A
+		parts = append(parts, fmt.Sprintf("%d or more letters", max(1, settings.MinLength)))
 	}
+	if settings.Lives > 0 {
+		parts = append(parts, fmt.Sprintf("%d lives", settings.Lives))
+	} else {
+		parts = append(parts, "unlimited lives")
+	}
+	if settings.Race {
+		parts = append(parts, "race")
+	}
+	fmt.Printf("Game settings: %s\n", strings.Join(parts, ", "))
+}
 
-	err = json.Unmarshal(plaintext, &client.message)
-	if err != nil {
-		log.Printf("- ERROR - Deserialisation error occured for incoming message - %s\n", err)
+// printHint ... prints a hint from the server, along with the lives left if the game can be
+// lost and the letters guessed so far.
+func printHint(message protocol.Message) {
+	fmt.Println(string(message.Content))
+	printStatus(message.Status)
+}
+
+// printStatus ... prints the lives left and letters guessed in a game, if there's anything to show.
+func printStatus(status *protocol.GameStatus) {
+	if status == nil {
+		return
+	}
+	var parts []string
+	if status.MaxLives > 0 {
+		parts = append(parts, fmt.Sprintf("lives: %d/%d", status.Lives, status.MaxLives))
+	}
+	if status.Guessed != "" {
+		parts = append(parts, fmt.Sprintf("guessed: %s", strings.Join(strings.Split(status.Guessed, ""), " ")))
+	}
+	if len(parts) > 0 {
+		fmt.Printf("    %s\n", strings.Join(parts, "    "))
 	}
 }
 
-func encryptJSONAddToChannel(client *client, plaintextMessageJSON []byte) {
-	var encrypted []byte
-	var nonce []byte
-	var encryptedAndValidated []byte
+// handleHello ... checks the server chose a version, suite and features we offered, then
+// begins the handshake for the chosen suite.
+func handleHello(client *client, message protocol.Message) {
+	if _, ok := client.session.Negotiated(); ok || message.Hello == nil {
+		fmt.Println("ERROR - Server sent an unexpected HELLO")
+		os.Exit(1)
+	}
+	if err := client.hello.Check(*message.Hello); err != nil {
+		fmt.Printf("ERROR - %s\n", err)
+		os.Exit(1)
+	}
+	if client.settings != nil && client.settings.Race && !message.Hello.Has(protocol.FeatureRace) {
+		fmt.Println("ERROR - Server doesn't support races")
+		os.Exit(1)
+	}
+	client.session.SetNegotiated(*message.Hello)
+	switch message.Hello.Suite() {
+	case protocol.SuiteRSA:
+		initPubKeyReq(client)
+	case protocol.SuiteECDHE:
+		initECDHEReq(client)
+	default:
+		// TLS has already authenticated the server and encrypted the connection.
+		client.sendMessage(protocol.Message{Content: []byte(protocol.StartGame), Settings: client.settings})
+	}
+}
 
-	if len(client.symmetricKey) > 0 {
-		encrypted, nonce = encryptAEADGCM(client.symmetricKey, plaintextMessageJSON)
-		encryptedAndValidated = generateEncryptedMessage(encrypted, nonce)
+// Handle the message containing a servers public key and initiate
+// the game with them.
+func handlePubKeyResp(client *client, message protocol.Message) {
+	var serverPubKey rsa.PublicKey
+	err := json.Unmarshal(message.Content, &serverPubKey)
+	if err != nil {
+		log.Printf("- ERROR - Deserialisation error - %s\n", err)
 	} else {
-		encrypted = encrypt(plaintextMessageJSON, serverPubKey)
-		encryptedAndValidated = generateEncryptedMessage(encrypted, nil)
+		client.session.EnableEncryption(&serverPubKey)
+		client.sendMessage(protocol.Message{Mtype: protocol.KindSymKeyReq})
+	}
+}
+
+// handleSymKeyResp ... Handle the message containing a symmetric key
+// and initiate gameplay with encryptedMessage{}s
+func handleSymKeyResp(client *client, message protocol.Message) {
+	// Now encrypt using symmetric key
+	if err := client.session.SetSymmetricKey(message.Content); err != nil {
+		log.Printf("- CRYPTO - Server sent an unusable session key - %s\n", err)
+		os.Exit(1)
 	}
-	client.data <- encryptedAndValidated
-	// log.Printf("- TO - %s - PT:%s\n", client.socket.RemoteAddr().String(), plaintextMessageJSON)
-	client.message = message{}
-	client.encmsg = encryptedMessage{}
+	startGame(client)
 }
 
-func generateHangmanJSONMessage(msg []byte, hash []byte) []byte {
-	messageStruct := message{Content: msg, Hash: hash}
-	messageBytes, err := json.Marshal(messageStruct)
+// handleECDHEResp ... verifies the servers signature over both key shares, derives the
+// session key and initiates gameplay with encryptedMessage{}s
+func handleECDHEResp(client *client, message protocol.Message) {
+	if client.ecdheKey == nil {
+		log.Printf("- CRYPTO - Received an ECDHERESP without sending an ECDHEREQ\n")
+		os.Exit(1)
+	}
+	clientShare := client.ecdheKey.PublicKey().Bytes()
+	// The session has already switched to the servers advertised key if it sent a trusted certificate.
+	err := protocol.VerifyECDHEShares(clientShare, message.Content, message.Signature, client.session.VerificationKey())
 	if err != nil {
-		log.Printf("- ENCODING - %s", err)
+		log.Printf("- CRYPTO - Failed to verify the servers key share - %s\n", err)
+		os.Exit(1)
+	}
+	AEADKey, err := protocol.DeriveECDHESessionKey(client.ecdheKey, clientShare, message.Content)
+	if err != nil {
+		log.Printf("- CRYPTO - Failed to derive the session key - %s\n", err)
+		os.Exit(1)
 	}
-	return messageBytes
+	// The ephemeral key is no longer needed once the session key is derived.
+	client.ecdheKey = nil
+	if err := client.session.SetSymmetricKey(AEADKey); err != nil {
+		log.Printf("- CRYPTO - Failed to set the session key - %s\n", err)
+		os.Exit(1)
+	}
+	startGame(client)
 }
 
-// Parse a byte representation of a message struct into a encryptedMessage struct and
-// attach a message authentication token (signed copy of the message) to the encrypted messageStruct
-func generateEncryptedMessage(messageBytes []byte, nonce []byte) []byte {
-	// we don't sign the byte encoded representation of the message struct for comms to the server
-	// because we don't have certificates for the clients, and i need to trust the server, but don't care
-	// if the clients go rogue.
-	enc := encryptedMessage{A: messageBytes, B: nonce}
-	// enc.Sign(&privkey)
+// startGame ... authenticates with our certificate if we have one, then sends START GAME.
+func startGame(client *client) {
+	if hello, _ := client.session.Negotiated(); client.certificate != nil && !hello.Has(protocol.FeatureClientAuth) {
+		log.Printf("- AUTH - Server doesn't accept client certificates, continuing without authenticating\n")
+	} else if client.certificate != nil {
+		signature, err := protocol.Sign(client.session.ChannelBinding(), client.certificate.PrivateKey.(*rsa.PrivateKey))
+		if err != nil {
+			log.Printf("- CRYPTO - Failed to sign client authentication - %s\n", err)
+			os.Exit(1)
+		}
+		client.sendMessage(protocol.Message{Mtype: protocol.KindClientAuth, Content: client.certificate.Certificate[0], Signature: signature})
+	}
+	client.sendMessage(protocol.Message{Content: []byte(protocol.StartGame), Settings: client.settings})
+	waitForOpponent(client.settings)
+}
 
-	benc, err := json.Marshal(enc)
+// sendMessage ... seals msg with the clients session and adds it to the data channel,
+// preceded by a REKEY if the key we send with has reached its limits.
+// Individual messages to the server aren't signed, clients with a certificate prove
+// their identity once per session with a CLIENTAUTH message instead.
+func (client *client) sendMessage(msg protocol.Message) {
+	if client.session.RekeyDue() {
+		frame, err := client.session.Rekey()
+		if err != nil {
+			log.Printf("- CRYPTO - Failed to replace the session key - %s", err)
+			os.Exit(1)
+		}
+		client.data <- frame
+	}
+	frame, err := client.session.Seal(msg)
 	if err != nil {
-		log.Printf("- ENCODING - %s", err)
+		log.Printf("- ERROR - Output will not be passed on - %s", err)
+		return
 	}
-	return benc
+	client.data <- frame
 }
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// waitForOpponent ... lets the player know the game won't start until the server has found
+// them an opponent, if they asked for a race.
+func waitForOpponent(settings *protocol.GameSettings) {
+	if settings != nil && settings.Race {
+		fmt.Println("Waiting for an opponent...")
+	}
+}
+
+// opponentName ... returns how to refer to the opponent, by name if they authenticated.
+func opponentName(name string) string {
+	if name == "" {
+		return "Your opponent"
+	}
+	return name
+}
+
+// handleOpponent ... prints the progress of our opponent in a race. The first OPPONENT of a
+// game introduces them.
+func (client *client) handleOpponent(status *protocol.OpponentStatus) {
+	if status == nil {
+		return
+	}
+	name := opponentName(status.Name)
+	switch {
+	case client.opponent == nil:
+		if status.Name != "" {
+			fmt.Printf("Racing %s, the first to guess the word wins!\n", status.Name)
+		} else {
+			fmt.Println("Opponent found, the first to guess the word wins!")
+		}
+	case status.Left:
+		fmt.Printf("%s left the race.\n", name)
+	case status.Out:
+		fmt.Printf("%s ran out of lives.\n", name)
+	default:
+		fmt.Printf("%s has found %d/%d letters", name, status.Revealed, status.Letters)
+		if status.MaxLives > 0 {
+			fmt.Printf(", lives: %d/%d", status.Lives, status.MaxLives)
+		}
+		fmt.Println()
+	}
+	client.opponent = status
+}
+
+// printRaceResult ... prints how our opponent finished a race.
+func printRaceResult(result *protocol.RaceResult) {
+	if result == nil {
+		return
+	}
+	name := opponentName(result.Opponent)
+	switch result.Outcome {
+	case protocol.OutcomeWon:
+		fmt.Printf("%s won the race, scoring %d.\n", name, result.Score)
+	case protocol.OutcomeLost:
+		fmt.Printf("%s ran out of lives.\n", name)
+	case protocol.OutcomeForfeit:
+		fmt.Printf("%s forfeited the race.\n", name)
+	case protocol.OutcomeBeaten:
+		fmt.Printf("%s was beaten to the answer.\n", name)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// quitTimeout ... how long to wait for the server's SUMMARY after sending QUIT.
+const quitTimeout = 5 * time.Second
+
+// endRound ... finishes a game once its GAME OVER has been printed. If the server supports
+// rounds the game hash is cleared for the next game and the player is asked whether to play
+// another, which the next line of input answers, otherwise the client exits.
+func (client *client) endRound(result *protocol.GameResult) {
+	if hello, _ := client.session.Negotiated(); !hello.Has(protocol.FeatureRounds) {
+		os.Exit(0)
+	}
+	client.gameMu.Lock()
+	client.gameHash = nil
+	client.gameHashMatched = false
+	client.gameStarted = make(chan struct{})
+	client.gameMu.Unlock()
+	if result != nil && result.Round > 0 {
+		fmt.Printf("Round %d complete, session total: %d\n", result.Round, result.Total)
+	}
+	fmt.Println("Play another round? (y/n)")
+	client.gameOver <- struct{}{}
+}
+
+// newGame ... asks the server for another round with the same settings as the first, and
+// waits for its first hint. The new game has its own game hash, which the hint carries.
+func (client *client) newGame() {
+	started := client.started()
+	client.sendMessage(protocol.Message{Mtype: protocol.KindNewGame, Settings: client.settings})
+	waitForOpponent(client.settings)
+	<-started
+}
+
+// started ... returns the channel closed once the first hint of the next game has arrived.
+func (client *client) started() chan struct{} {
+	client.gameMu.Lock()
+	defer client.gameMu.Unlock()
+	return client.gameStarted
+}
+
+// quit ... ends the session. If the server supports rounds it's sent QUIT and the SUMMARY it
+// replies with exits the client, otherwise the connection is just closed.
+func (client *client) quit() {
+	fmt.Println("CLIENT - Exiting hangmango client")
+	if hello, _ := client.session.Negotiated(); hello.Has(protocol.FeatureRounds) {
+		client.sendMessage(protocol.Message{Mtype: protocol.KindQuit})
+		time.Sleep(quitTimeout)
+	}
+	client.socket.Close()
+	os.Exit(0)
+}
+
+// printSummary ... prints every round played in the session and the total score.
+func printSummary(summary *protocol.SessionSummary) {
+	if summary == nil {
+		return
+	}
+	fmt.Printf("Session summary, rounds played: %d\n", len(summary.Rounds))
+	for i, round := range summary.Rounds {
+		fmt.Printf("    round %d: %s %s, scored %d\n", i+1, round.Outcome, round.Answer, round.Score)
+	}
+	fmt.Printf("Total score: %d\n", summary.Total)
+}
@@ -0,0 +1,58 @@
+package hangmango
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// normalizeAnswer ... lowercases an answer, normalises it to NFC and collapses the whitespace
+// between its words, returning an error if it contains anything other than letters and
+// separators, or is too long to be guessed as a whole. Whether the letters are in the
+// server's alphabet is checked by NewServer, once every option is applied.
+func normalizeAnswer(answer string) (string, error) {
+	if !utf8.ValidString(answer) {
+		return "", fmt.Errorf("answer %q isn't UTF-8 text", answer)
+	}
+	normalized := protocol.Normalize(strings.ToLower(strings.Join(strings.Fields(answer), " ")))
+	letters := 0
+	for _, r := range normalized {
+		if unicode.IsLetter(r) {
+			letters++
+		} else if !protocol.IsSeparator(r) {
+			return "", fmt.Errorf("answer %q may only contain letters, spaces, hyphens and apostrophes", answer)
+		}
+	}
+	if letters == 0 {
+		return "", fmt.Errorf("answer %q has no letters", answer)
+	}
+	if utf8.RuneCountInString(normalized) > maxGuessLength {
+		return "", fmt.Errorf("answer %q is longer than %d characters, the longest guess permitted", answer, maxGuessLength)
+	}
+	return normalized, nil
+}
+
+// normalizeGuess ... returns only the letters of a guess or answer, lowercased, so a phrase
+// compares equal however it was spaced or punctuated.
+func normalizeGuess(guess string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, guess)
+}
+
+// maskAnswer ... returns the first hint for answer, with every letter hidden by an underscore
+// and separators revealed.
+func maskAnswer(answer string) string {
+	return strings.Map(func(r rune) rune {
+		if protocol.IsSeparator(r) {
+			return r
+		}
+		return '_'
+	}, answer)
+}
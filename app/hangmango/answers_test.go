@@ -0,0 +1,57 @@
+package hangmango
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNormalizeAnswer(t *testing.T) {
+	tests := []struct {
+		name    string
+		answer  string
+		want    string
+		wantErr bool
+	}{
+		{name: "word", answer: "apple", want: "apple"},
+		{name: "uppercase", answer: "Apple", want: "apple"},
+		{name: "phrase", answer: "Jack-in-the-box", want: "jack-in-the-box"},
+		{name: "whitespace collapsed", answer: "  don't \t panic ", want: "don't panic"},
+		{name: "letters outside A-Z", answer: "\u00c4pfel", want: "\u00e4pfel"},
+		{name: "combining mark composed", answer: "A\u0308pfel", want: "\u00e4pfel"},
+		{name: "longest answer", answer: strings.Repeat("a", maxGuessLength), want: strings.Repeat("a", maxGuessLength)},
+		{name: "too long", answer: strings.Repeat("a", maxGuessLength+1), wantErr: true},
+		{name: "empty", answer: "", wantErr: true},
+		{name: "separators only", answer: "- '", wantErr: true},
+		{name: "digit", answer: "catch 22", wantErr: true},
+		{name: "punctuation", answer: "hello!", wantErr: true},
+		{name: "invalid UTF-8", answer: "\xff", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := normalizeAnswer(test.answer)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("normalizeAnswer(%q) error = %v, want error %v", test.answer, err, test.wantErr)
+			}
+			if got != test.want {
+				t.Fatalf("normalizeAnswer(%q) = %q, want %q", test.answer, got, test.want)
+			}
+		})
+	}
+}
+
+func TestMaskAnswer(t *testing.T) {
+	tests := []struct {
+		answer string
+		want   string
+	}{
+		{answer: "apple", want: "_____"},
+		{answer: "jack-in-the-box", want: "____-__-___-___"},
+		{answer: "don't panic", want: "___'_ _____"},
+		{answer: "stra\u00dfe", want: "______"},
+	}
+	for _, test := range tests {
+		if got := maskAnswer(test.answer); got != test.want {
+			t.Errorf("maskAnswer(%q) = %q, want %q", test.answer, got, test.want)
+		}
+	}
+}
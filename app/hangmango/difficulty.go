@@ -0,0 +1,60 @@
+package hangmango
+
+import (
+	"fmt"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// difficulties ... the settings each protocol.Difficulty stands for, a MaxLength of 0 is
+// unbounded.
+var difficulties = map[protocol.Difficulty]protocol.GameSettings{
+	protocol.DifficultyEasy:   {Difficulty: protocol.DifficultyEasy, MinLength: 1, MaxLength: 6, Lives: 8},
+	protocol.DifficultyMedium: {Difficulty: protocol.DifficultyMedium, MinLength: 5, MaxLength: 8, Lives: 6},
+	protocol.DifficultyHard:   {Difficulty: protocol.DifficultyHard, MinLength: 8, Lives: 4},
+}
+
+// resolveSettings ... fills in the settings a client asked for in START GAME from the
+// difficulty preset and the server's defaults, returning them with the answers that fit.
+// Without settings the game uses every answer and the server's lives.
+func (server *Server) resolveSettings(requested *protocol.GameSettings) (protocol.GameSettings, []string, error) {
+	settings := protocol.GameSettings{Lives: server.lives}
+	if requested == nil {
+		return settings, server.answerPool, nil
+	}
+	if err := requested.Check(); err != nil {
+		return settings, nil, err
+	}
+	if requested.Difficulty != "" {
+		settings = difficulties[requested.Difficulty]
+	}
+	if requested.MinLength > 0 {
+		settings.MinLength = requested.MinLength
+	}
+	if requested.MaxLength > 0 {
+		settings.MaxLength = requested.MaxLength
+	}
+	if requested.Lives > 0 {
+		settings.Lives = requested.Lives
+	}
+	settings.Race = requested.Race
+	// A preset combined with an explicit length can still contradict itself.
+	if err := settings.Check(); err != nil {
+		return settings, nil, err
+	}
+
+	var pool []string
+	for _, answer := range server.answerPool {
+		length := countLetters(answer)
+		if length >= settings.MinLength && (settings.MaxLength == 0 || length <= settings.MaxLength) {
+			pool = append(pool, answer)
+		}
+	}
+	if len(pool) == 0 && settings.MaxLength == 0 {
+		return settings, nil, fmt.Errorf("no answers have %d or more letters", settings.MinLength)
+	}
+	if len(pool) == 0 {
+		return settings, nil, fmt.Errorf("no answers have between %d and %d letters", settings.MinLength, settings.MaxLength)
+	}
+	return settings, pool, nil
+}
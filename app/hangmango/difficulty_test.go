@@ -0,0 +1,95 @@
+package hangmango
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+func TestResolveSettings(t *testing.T) {
+	words := []string{"ox", "apple", "banana", "elephant", "jack-in-the-box"}
+	tests := []struct {
+		name      string
+		requested *protocol.GameSettings
+		want      protocol.GameSettings
+		wantPool  []string
+		wantErr   bool
+	}{
+		{name: "no settings", want: protocol.GameSettings{Lives: 5}, wantPool: words},
+		{name: "empty settings", requested: &protocol.GameSettings{}, want: protocol.GameSettings{Lives: 5}, wantPool: words},
+		{
+			name:      "easy",
+			requested: &protocol.GameSettings{Difficulty: protocol.DifficultyEasy},
+			want:      difficulties[protocol.DifficultyEasy],
+			wantPool:  []string{"ox", "apple", "banana"},
+		},
+		{
+			name:      "medium",
+			requested: &protocol.GameSettings{Difficulty: protocol.DifficultyMedium},
+			want:      difficulties[protocol.DifficultyMedium],
+			wantPool:  []string{"apple", "banana", "elephant"},
+		},
+		{
+			name:      "hard",
+			requested: &protocol.GameSettings{Difficulty: protocol.DifficultyHard},
+			want:      difficulties[protocol.DifficultyHard],
+			wantPool:  []string{"elephant", "jack-in-the-box"},
+		},
+		{
+			name:      "difficulty with lives",
+			requested: &protocol.GameSettings{Difficulty: protocol.DifficultyHard, Lives: 2},
+			want:      protocol.GameSettings{Difficulty: protocol.DifficultyHard, MinLength: 8, Lives: 2},
+			wantPool:  []string{"elephant", "jack-in-the-box"},
+		},
+		{
+			name:      "difficulty with a length",
+			requested: &protocol.GameSettings{Difficulty: protocol.DifficultyEasy, MaxLength: 5},
+			want:      protocol.GameSettings{Difficulty: protocol.DifficultyEasy, MinLength: 1, MaxLength: 5, Lives: 8},
+			wantPool:  []string{"ox", "apple"},
+		},
+		{
+			name:      "lengths",
+			requested: &protocol.GameSettings{MinLength: 6, MaxLength: 8},
+			want:      protocol.GameSettings{MinLength: 6, MaxLength: 8, Lives: 5},
+			wantPool:  []string{"banana", "elephant"},
+		},
+		{
+			name:      "phrase length counts letters",
+			requested: &protocol.GameSettings{MinLength: 12, MaxLength: 12},
+			want:      protocol.GameSettings{MinLength: 12, MaxLength: 12, Lives: 5},
+			wantPool:  []string{"jack-in-the-box"},
+		},
+		{
+			name:      "lives",
+			requested: &protocol.GameSettings{Lives: 3},
+			want:      protocol.GameSettings{Lives: 3},
+			wantPool:  words,
+		},
+		{name: "unknown difficulty", requested: &protocol.GameSettings{Difficulty: "impossible"}, wantErr: true},
+		{name: "negative length", requested: &protocol.GameSettings{MinLength: -1}, wantErr: true},
+		{name: "negative lives", requested: &protocol.GameSettings{Lives: -1}, wantErr: true},
+		{name: "minimum over maximum", requested: &protocol.GameSettings{MinLength: 6, MaxLength: 5}, wantErr: true},
+		{name: "difficulty contradicting a length", requested: &protocol.GameSettings{Difficulty: protocol.DifficultyHard, MaxLength: 6}, wantErr: true},
+		{name: "no answers long enough", requested: &protocol.GameSettings{MinLength: 20}, wantErr: true},
+		{name: "no answers between lengths", requested: &protocol.GameSettings{MinLength: 3, MaxLength: 4}, wantErr: true},
+	}
+	server := newTestServer(t, WithWords(words), WithLives(5))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings, pool, err := server.resolveSettings(test.requested)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("resolveSettings(%v) error = %v, want error %v", test.requested, err, test.wantErr)
+			}
+			if test.wantErr {
+				return
+			}
+			if settings != test.want {
+				t.Errorf("resolveSettings(%v) settings = %+v, want %+v", test.requested, settings, test.want)
+			}
+			if !slices.Equal(pool, test.wantPool) {
+				t.Errorf("resolveSettings(%v) pool = %q, want %q", test.requested, pool, test.wantPool)
+			}
+		})
+	}
+}
@@ -1,9 +1,8 @@
-package main
+package hangmango
 
 import (
 	"crypto/sha256"
 	"fmt"
-	"log"
 	"time"
 )
 
@@ -18,7 +17,7 @@ func (client *client) generateGameHash() {
 	t := time.Now().UTC().Truncate(m)
 	tbytes, err := t.MarshalText()
 	if err != nil {
-		log.Printf("- GAMEHASH - error marshalling current time to bytes - %s", err)
+		client.server.logger.Printf("- GAMEHASH - error marshalling current time to bytes - %s", err)
 	}
 
 	// Get the initially selected word by the server
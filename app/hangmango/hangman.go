@@ -0,0 +1,178 @@
+package hangmango
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// DefaultLives ... wrong guesses a client can make before losing unless WithLives is used,
+// one for each part of the classic hangman drawing.
+const DefaultLives = 6
+
+// HangmanState ... State of a game per client.
+type HangmanState struct {
+	// client  *Client
+	turn        bool
+	answer      string
+	guesses     []string
+	wordguesses []string
+	hint        string
+	valid       bool
+	score       int
+	// lives is the number of wrong guesses left out of maxLives, a maxLives of zero
+	// means the game can't be lost.
+	lives    int
+	maxLives int
+	outcome  protocol.Outcome
+	// missedLetters and missedWords count wrong guesses and started is when the game
+	// was created, for the scorer.
+	missedLetters int
+	missedWords   int
+	started       time.Time
+	scorer        Scorer
+	// repeated is set by process when the guess was made before.
+	repeated bool
+}
+
+// NewGame ... Initialise a game with a new random word from answerPool.
+func (state *HangmanState) NewGame(answerPool []string) {
+	rand.Seed(time.Now().UnixNano())
+	state.answer = answerPool[rand.Intn(len(answerPool))]
+	state.hint = maskAnswer(state.answer)
+	state.started = time.Now()
+}
+
+// process ... Handles turn by turn logic for a hangman game and returns
+// the string to send back to the client. If the guess was made before, repeated
+// is set and the hint is returned unchanged.
+// Guesses over 100 characters in length return an error message back
+// to the client.
+func (state *HangmanState) process(message string) string {
+	message = strings.ToLower(message)
+
+	// A repeated guess doesn't change the game or cost anything.
+	state.repeated = state.guessed(message)
+	if state.repeated {
+		return state.hint
+	}
+
+	length := utf8.RuneCountInString(message)
+	if length == 1 {
+		state.guesses = append(state.guesses, message)
+		// single letter guess
+		positions := getPositionsInString(state.answer, message)
+		state.updateHint(positions, message)
+		if strings.Index(state.hint, "_") == -1 {
+			// If there's no more underscores in the server generated hint string, the player has guessed the correct word.
+			return state.win()
+		}
+		if len(positions) == 0 {
+			state.missedLetters++
+			if state.miss() {
+				return fmt.Sprintf("%d", state.score)
+			}
+		}
+	}
+	if (length > 1) && (length <= 100) {
+		// word guess, only correct if the client guesses the entire answer. Phrases are
+		// compared by their letters alone, ignoring spacing and punctuation.
+		state.wordguesses = append(state.wordguesses, normalizeGuess(message))
+		if normalizeGuess(state.answer) == normalizeGuess(message) {
+			return state.win()
+		}
+		state.missedWords++
+		if state.miss() {
+			return fmt.Sprintf("%d", state.score)
+		}
+	}
+	if length > 100 {
+		return "Guesses are limited to 100 characters in length."
+	}
+	return state.hint
+}
+
+// guessed ... reports whether the letter or word guess has already been made.
+func (state *HangmanState) guessed(guess string) bool {
+	if utf8.RuneCountInString(guess) == 1 {
+		return slices.Contains(state.guesses, guess)
+	}
+	return slices.Contains(state.wordguesses, normalizeGuess(guess))
+}
+
+// win ... ends the game as won and returns the score to send back to the client.
+func (state *HangmanState) win() string {
+	state.calculateScore()
+	state.valid = false
+	state.outcome = protocol.OutcomeWon
+	return fmt.Sprintf("%d", state.score)
+}
+
+// miss ... takes a life for a wrong guess and ends the game as lost, with no score, once
+// none are left. Returns true if the game is over.
+func (state *HangmanState) miss() bool {
+	if state.maxLives == 0 {
+		return false
+	}
+	state.lives--
+	if state.lives > 0 {
+		return false
+	}
+	state.score = 0
+	state.valid = false
+	state.outcome = protocol.OutcomeLost
+	return true
+}
+
+// status ... returns the state of the game sent to the client with each hint.
+func (state *HangmanState) status() *protocol.GameStatus {
+	guessed := slices.Clone(state.guesses)
+	slices.Sort(guessed)
+	return &protocol.GameStatus{Lives: state.lives, MaxLives: state.maxLives, Guessed: strings.Join(guessed, "")}
+}
+
+// updateHint ... uses a list of integers that represent rune positions in the answer
+// string to fill a correctly guessed letter in the state.hint
+func (state *HangmanState) updateHint(positions []int, updateChar string) {
+	temp := []rune(state.hint)
+	letter, _ := utf8.DecodeRuneInString(updateChar)
+	for _, c := range positions {
+		temp[c] = letter
+	}
+	state.hint = string(temp)
+}
+
+// calculateScore ... Calulate the state's score using the scorer the game was created with,
+// or the formula prescribed in the criteria if it has none.
+func (state *HangmanState) calculateScore() {
+	scorer := state.scorer
+	if scorer == nil {
+		scorer = OriginalScorer{}
+	}
+	state.score = scorer.Score(ScoredGame{
+		Answer:        state.answer,
+		Guesses:       state.guesses,
+		WordGuesses:   state.wordguesses,
+		MissedLetters: state.missedLetters,
+		MissedWords:   state.missedWords,
+		Duration:      time.Since(state.started),
+	})
+}
+
+// getPositionsInString ... returns a slice of integers containing the rune indexes
+// in message for each occurance of the search character. For example, if the target
+// was "ÄÄÄÄÄ" and the search was 'Ä', a slice of [0,1,2,3,4] will be returned.
+func getPositionsInString(target string, search string) []int {
+	var indexes []int
+	for i, c := range []rune(target) {
+		if string(c) == search {
+			indexes = append(indexes, i)
+		}
+	}
+	return indexes
+}
@@ -0,0 +1,132 @@
+package hangmango
+
+import (
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// newTestGame ... returns a game in progress for answer that's lost after lives wrong guesses.
+func newTestGame(answer string, lives int) *HangmanState {
+	state := &HangmanState{valid: true, lives: lives, maxLives: lives}
+	state.NewGame([]string{answer})
+	return state
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name         string
+		answer       string
+		lives        int
+		guesses      []string
+		want         string
+		wantLives    int
+		wantOutcome  protocol.Outcome
+		wantRepeated bool
+		wantGuessed  string
+	}{
+		{name: "letter", answer: "apple", lives: 6, guesses: []string{"p"}, want: "_pp__", wantLives: 6, wantGuessed: "p"},
+		{name: "uppercase letter", answer: "apple", lives: 6, guesses: []string{"P"}, want: "_pp__", wantLives: 6, wantGuessed: "p"},
+		{name: "wrong letter", answer: "apple", lives: 6, guesses: []string{"x"}, want: "_____", wantLives: 5, wantGuessed: "x"},
+		{name: "wrong word", answer: "apple", lives: 6, guesses: []string{"grape"}, want: "_____", wantLives: 5},
+		{name: "right letter with one life left", answer: "apple", lives: 1, guesses: []string{"a"}, want: "a____", wantLives: 1, wantGuessed: "a"},
+		{name: "guessed letters sorted", answer: "apple", lives: 6, guesses: []string{"p", "x", "a"}, want: "app__", wantLives: 5, wantGuessed: "apx"},
+		{name: "every occurrence of a letter", answer: "aaaaaaaaaaaab", lives: 6, guesses: []string{"a"}, want: "aaaaaaaaaaaa_", wantLives: 6, wantGuessed: "a"},
+		{name: "phrase separators revealed", answer: "jack-in-the-box", lives: 6, guesses: []string{"x"}, want: "____-__-___-__x", wantLives: 6, wantGuessed: "x"},
+		{name: "letter in a phrase", answer: "don't panic", lives: 6, guesses: []string{"n"}, want: "__n'_ __n__", wantLives: 6, wantGuessed: "n"},
+		{name: "letter outside A-Z", answer: "stra\u00dfe", lives: 6, guesses: []string{"\u00df"}, want: "____\u00df_", wantLives: 6, wantGuessed: "\u00df"},
+		{name: "uppercase letter outside A-Z", answer: "\u00fcber", lives: 6, guesses: []string{"\u00dc"}, want: "\u00fc___", wantLives: 6, wantGuessed: "\u00fc"},
+		{name: "repeated letter", answer: "apple", lives: 6, guesses: []string{"a", "A"}, want: "a____", wantLives: 6, wantRepeated: true, wantGuessed: "a"},
+		{name: "repeated wrong letter", answer: "apple", lives: 6, guesses: []string{"x", "p", "x"}, want: "_pp__", wantLives: 5, wantRepeated: true, wantGuessed: "px"},
+		{name: "repeated wrong word", answer: "apple", lives: 6, guesses: []string{"grape", "GRAPE"}, want: "_____", wantLives: 5, wantRepeated: true},
+		{
+			name:        "won with letters",
+			answer:      "apple",
+			lives:       6,
+			guesses:     []string{"a", "x", "p", "l", "e"},
+			want:        "40",
+			wantLives:   5,
+			wantOutcome: protocol.OutcomeWon,
+			wantGuessed: "aelpx",
+		},
+		{
+			name:        "won after repeating a letter",
+			answer:      "apple",
+			lives:       6,
+			guesses:     []string{"a", "a", "p", "l", "e"},
+			want:        "42",
+			wantLives:   6,
+			wantOutcome: protocol.OutcomeWon,
+			wantGuessed: "aelp",
+		},
+		{name: "won with a word", answer: "apple", lives: 6, guesses: []string{"Apple"}, want: "49", wantLives: 6, wantOutcome: protocol.OutcomeWon},
+		{
+			name:        "won with a phrase spaced differently",
+			answer:      "jack-in-the-box",
+			lives:       6,
+			guesses:     []string{"Jack in the box"},
+			want:        "119",
+			wantLives:   6,
+			wantOutcome: protocol.OutcomeWon,
+		},
+		{
+			name:        "won with a phrase's letters",
+			answer:      "don't panic",
+			lives:       6,
+			guesses:     []string{"dontpanic"},
+			want:        "89",
+			wantLives:   6,
+			wantOutcome: protocol.OutcomeWon,
+		},
+		{
+			name:        "lost with letters",
+			answer:      "apple",
+			lives:       2,
+			guesses:     []string{"x", "a", "y"},
+			want:        "0",
+			wantLives:   0,
+			wantOutcome: protocol.OutcomeLost,
+			wantGuessed: "axy",
+		},
+		{name: "lost with a word", answer: "apple", lives: 1, guesses: []string{"grape"}, want: "0", wantLives: 0, wantOutcome: protocol.OutcomeLost},
+		{
+			name:        "unlimited lives",
+			answer:      "apple",
+			lives:       0,
+			guesses:     []string{"b", "c", "d", "f", "g", "h", "i", "j"},
+			want:        "_____",
+			wantLives:   0,
+			wantGuessed: "bcdfghij",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := newTestGame(test.answer, test.lives)
+			var got string
+			for _, guess := range test.guesses {
+				if !state.valid {
+					t.Fatalf("game ended before %q was guessed", guess)
+				}
+				got = state.process(guess)
+			}
+			if got != test.want {
+				t.Errorf("process() = %q, want %q", got, test.want)
+			}
+			if state.lives != test.wantLives {
+				t.Errorf("lives = %d, want %d", state.lives, test.wantLives)
+			}
+			if state.outcome != test.wantOutcome {
+				t.Errorf("outcome = %q, want %q", state.outcome, test.wantOutcome)
+			}
+			if over := test.wantOutcome != ""; state.valid == over {
+				t.Errorf("valid = %v, want %v", state.valid, !over)
+			}
+			if state.repeated != test.wantRepeated {
+				t.Errorf("repeated = %v, want %v", state.repeated, test.wantRepeated)
+			}
+			if guessed := state.status().Guessed; guessed != test.wantGuessed {
+				t.Errorf("status().Guessed = %q, want %q", guessed, test.wantGuessed)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package hangmango
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// DefaultKeyOverlap ... how long the previous keys keep being offered to clients after
+// RotateKeys unless WithKeyOverlap is used.
+const DefaultKeyOverlap = 24 * time.Hour
+
+// keySet ... the server's keys at one point in its rotation, identified by the key ID
+// of the signing key.
+type keySet struct {
+	id                string
+	encryptionKey     *rsa.PrivateKey
+	encryptionKeyJSON []byte
+	signingKey        *rsa.PrivateKey
+	certificate       []byte
+}
+
+// newKeySet ... checks certificate, if there is one, was issued for signingKey and returns
+// the keySet for the keys.
+func newKeySet(encryptionKey *rsa.PrivateKey, signingKey *rsa.PrivateKey, certificate []byte) (*keySet, error) {
+	if encryptionKey == nil || signingKey == nil {
+		return nil, errors.New("hangmango: both an encryption and a signing key are required")
+	}
+	if certificate != nil {
+		parsed, err := x509.ParseCertificate(certificate)
+		if err != nil {
+			return nil, fmt.Errorf("hangmango: parsing certificate - %s", err)
+		}
+		if !signingKey.PublicKey.Equal(parsed.PublicKey) {
+			return nil, errors.New("hangmango: certificate wasn't issued for the signing key")
+		}
+	}
+	kObj, err := json.Marshal(encryptionKey.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("hangmango: encoding public key - %s", err)
+	}
+	return &keySet{
+		id:                protocol.KeyID(&signingKey.PublicKey),
+		encryptionKey:     encryptionKey,
+		encryptionKeyJSON: kObj,
+		signingKey:        signingKey,
+		certificate:       certificate,
+	}, nil
+}
+
+// WithCertificate ... sets the DER encoded certificate issued for the signing key given to
+// WithKeys. It's sent to clients during the handshake along with the key ID, so clients
+// that trust the issuing CA can verify keys introduced by RotateKeys.
+func WithCertificate(certificate []byte) Option {
+	return func(server *Server) error {
+		server.certificate = append([]byte(nil), certificate...)
+		return nil
+	}
+}
+
+// WithKeyOverlap ... sets how long the previous keys are still used for clients that ask for
+// them after RotateKeys, giving clients holding the old certificate time to be updated.
+func WithKeyOverlap(overlap time.Duration) Option {
+	return func(server *Server) error {
+		if overlap < 0 {
+			return errors.New("hangmango: key overlap can't be negative")
+		}
+		server.keyOverlap = overlap
+		return nil
+	}
+}
+
+// RotateKeys ... replaces the keys new sessions are established with. Connected clients keep
+// the session they have and clients that ask for the previous signing key by its ID keep
+// being served with the previous keys until the overlap window set by WithKeyOverlap passes.
+func (server *Server) RotateKeys(encryptionKey *rsa.PrivateKey, signingKey *rsa.PrivateKey, certificate []byte) error {
+	keys, err := newKeySet(encryptionKey, signingKey, certificate)
+	if err != nil {
+		return err
+	}
+	server.keysMu.Lock()
+	defer server.keysMu.Unlock()
+	if keys.id != server.keys.id {
+		server.previousKeys = server.keys
+		server.previousUntil = time.Now().Add(server.keyOverlap)
+	}
+	server.keys = keys
+	server.logger.Printf("- CRYPTO - Rotated to key %s", keys.id)
+	return nil
+}
+
+// KeyID ... returns the ID of the signing key new sessions are established with.
+func (server *Server) KeyID() string {
+	return server.currentKeys().id
+}
+
+// currentKeys ... returns the keys new sessions are established with.
+func (server *Server) currentKeys() *keySet {
+	server.keysMu.RLock()
+	defer server.keysMu.RUnlock()
+	return server.keys
+}
+
+// keysFor ... returns the keys for a session with a client that holds the certificate for
+// the signing key id. That's the previous keys if the client asked for them and the overlap
+// window hasn't passed, otherwise the current keys.
+func (server *Server) keysFor(id string) *keySet {
+	server.keysMu.RLock()
+	defer server.keysMu.RUnlock()
+	if id != "" && server.previousKeys != nil && id == server.previousKeys.id && time.Now().Before(server.previousUntil) {
+		return server.previousKeys
+	}
+	return server.keys
+}
@@ -0,0 +1,136 @@
+package hangmango
+
+// legacy contains the plaintext line protocol from the original COSC540 specification
+// described in the readme, for netcat and course clients that can't speak the protocol
+// package. Every message is ASCII text terminated by a line feed and nothing is encrypted,
+// so it should only be served where that's acceptable.
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// legacyMaxLineLength ... longest line, including its line ending, accepted from a legacy
+// client. Longer lines are invalid and drop the connection.
+const legacyMaxLineLength = 128
+
+// errLegacyClientAuth ... returned by ServeLegacy when client authentication is required,
+// which legacy clients have no way to complete.
+var errLegacyClientAuth = errors.New("hangmango: legacy clients can't authenticate, but client authentication is required")
+
+// errLegacyAnswers ... returned by ServeLegacy when every answer has letters outside A-Z,
+// which legacy clients can't guess.
+var errLegacyAnswers = errors.New("hangmango: legacy clients can only guess A-Z, but every answer has other letters")
+
+// ServeLegacy ... accepts connections on listener and plays hangman with each of them using
+// the plaintext line protocol until Shutdown is called. Connections are never encrypted,
+// even if a TLS config was provided, so ServeLegacy refuses to run when client
+// authentication is required. The line protocol is ASCII, so guesses are validated with
+// protocol.AlphabetEnglish and games only use the answers written in it, whatever alphabet
+// the server uses. ServeLegacy always returns a non-nil error and closes listener.
+func (server *Server) ServeLegacy(listener net.Listener) error {
+	if server.requireClientAuth {
+		listener.Close()
+		return errLegacyClientAuth
+	}
+	if len(server.legacyAnswerPool) == 0 {
+		listener.Close()
+		return errLegacyAnswers
+	}
+	server.logger.Printf("- Started legacy line protocol server on %s\n", listener.Addr())
+	return server.serve(listener, server.handleLegacy)
+}
+
+// handleLegacy ... creates the client for a new legacy connection, registers it with the
+// clientManager so it's closed on Shutdown, and starts playing with it.
+func (server *Server) handleLegacy(connection net.Conn) {
+	client := &client{
+		server: server,
+		socket: connection,
+		data:   make(chan []byte),
+		stop:   make(chan struct{}),
+		guid:   fmt.Sprintf("%d", time.Now().Unix()),
+	}
+	if !server.manager.add(client) {
+		connection.Close()
+		return
+	}
+	go server.playLegacy(client)
+}
+
+// playLegacy ... reads lines from a legacy client and plays a single game with it. The
+// connection is dropped after the score and GAME OVER have been sent, or as soon as the
+// client sends anything the protocol doesn't allow.
+func (server *Server) playLegacy(client *client) {
+	defer server.manager.remove(client)
+	defer client.socket.Close()
+	address := client.socket.RemoteAddr().String()
+	reader := bufio.NewReaderSize(client.socket, legacyMaxLineLength)
+	for {
+		// ReadSlice fails rather than growing its buffer when a line is too long.
+		raw, err := reader.ReadSlice('\n')
+		if err != nil {
+			if errors.Is(err, bufio.ErrBufferFull) {
+				server.logger.Printf("- LEGACY - FROM - %s - Line longer than %d bytes, connection closed", address, legacyMaxLineLength)
+			} else if len(raw) > 0 {
+				server.logger.Printf("- LEGACY - FROM - %s - Connection closed part way through a line", address)
+			}
+			return
+		}
+		// Telnet and some course clients end lines with CR LF.
+		line := strings.TrimSuffix(strings.TrimSuffix(string(raw), "\n"), "\r")
+		server.logger.Printf("- LEGACY - FROM - %s - %q", address, line)
+
+		// Until a game is started the only valid message is START GAME, which is case sensitive.
+		if !client.state.valid {
+			if line != protocol.StartGame {
+				server.logger.Printf("- LEGACY - FROM - %s - Expected %s, connection closed", address, protocol.StartGame)
+				return
+			}
+			server.newGame(client, server.legacyAnswerPool, server.lives)
+			if !server.writeLegacy(client, client.state.hint) {
+				return
+			}
+			continue
+		}
+		// The line protocol has no way to reject a guess, so invalid guesses always drop the connection.
+		// Phrases are guessed without their separators, as only letters are permitted.
+		if err := validateGuess([]byte(line), protocol.AlphabetEnglish); err != nil {
+			server.logger.Printf("- VALIDATION - FROM - %s - %s, connection closed", address, err)
+			return
+		}
+		if strings.ContainsFunc(line, protocol.IsSeparator) {
+			server.logger.Printf("- VALIDATION - FROM - %s - invalid guess %q - the line protocol only permits letters, connection closed", address, line)
+			return
+		}
+		// The line protocol has no ALREADY GUESSED, a repeated guess is answered with the hint.
+		response := client.state.process(line)
+		if !client.state.valid {
+			// The game is over (won or lost), the score is followed by GAME OVER and the connection ends.
+			server.writeLegacy(client, response, string(protocol.KindGameOver))
+			return
+		}
+		if !server.writeLegacy(client, response) {
+			return
+		}
+	}
+}
+
+// writeLegacy ... writes each of lines to a legacy client terminated by a line feed,
+// returning false if the connection failed.
+func (server *Server) writeLegacy(client *client, lines ...string) bool {
+	for _, line := range lines {
+		if _, err := client.socket.Write([]byte(line + "\n")); err != nil {
+			server.logger.Printf("- ERROR - TO - %s - %s", client.socket.RemoteAddr().String(), err)
+			return false
+		}
+		server.logger.Printf("- LEGACY - TO - %s - %q", client.socket.RemoteAddr().String(), line)
+	}
+	return true
+}
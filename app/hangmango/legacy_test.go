@@ -0,0 +1,153 @@
+package hangmango
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// legacyStep ... a line sent by a legacy client and the lines it expects in reply.
+type legacyStep struct {
+	send string
+	want []string
+}
+
+func TestPlayLegacy(t *testing.T) {
+	tests := []struct {
+		name  string
+		opts  []Option
+		steps []legacyStep
+	}{
+		{
+			name: "won with letters",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "a\n", want: []string{"a____"}},
+				{send: "p\n", want: []string{"app__"}},
+				{send: "x\n", want: []string{"app__"}},
+				{send: "l\n", want: []string{"appl_"}},
+				{send: "e\n", want: []string{"40", "GAME OVER"}},
+			},
+		},
+		{
+			name: "won with a word",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "grape\n", want: []string{"_____"}},
+				{send: "APPLE\n", want: []string{"48", "GAME OVER"}},
+			},
+		},
+		{
+			name: "lost",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "b\n", want: []string{"_____"}},
+				{send: "c\n", want: []string{"_____"}},
+				{send: "d\n", want: []string{"_____"}},
+				{send: "f\n", want: []string{"_____"}},
+				{send: "g\n", want: []string{"_____"}},
+				{send: "h\n", want: []string{"0", "GAME OVER"}},
+			},
+		},
+		{
+			name: "repeated guess answered with the hint",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "p\n", want: []string{"_pp__"}},
+				{send: "P\n", want: []string{"_pp__"}},
+				{send: "apple\n", want: []string{"47", "GAME OVER"}},
+			},
+		},
+		{
+			name: "CR LF line endings",
+			steps: []legacyStep{
+				{send: "START GAME\r\n", want: []string{"_____"}},
+				{send: "apple\r\n", want: []string{"49", "GAME OVER"}},
+			},
+		},
+		{
+			name:  "guess before START GAME",
+			steps: []legacyStep{{send: "a\n"}},
+		},
+		{
+			name:  "START GAME in the wrong case",
+			steps: []legacyStep{{send: "start game\n"}},
+		},
+		{
+			name: "invalid guess",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "a1\n"},
+			},
+		},
+		{
+			name: "phrase",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "ap ple\n"},
+			},
+		},
+		{
+			name: "only A-Z answers with another alphabet",
+			opts: []Option{WithAlphabet(protocol.AlphabetGerman), WithWords([]string{"apple", "\u00e4pfel"})},
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "apple\n", want: []string{"49", "GAME OVER"}},
+			},
+		},
+		{
+			name: "letter outside A-Z with another alphabet",
+			opts: []Option{WithAlphabet(protocol.AlphabetGerman)},
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: "\u00e4\n"},
+			},
+		},
+		{
+			name: "line too long",
+			steps: []legacyStep{
+				{send: "START GAME\n", want: []string{"_____"}},
+				{send: strings.Repeat("a", legacyMaxLineLength) + "\n"},
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, WithWords([]string{"apple"}))
+			listener := newPipeListener()
+			go server.ServeLegacy(listener)
+			conn := listener.dial(t)
+			reader := bufio.NewReader(conn)
+
+			for _, step := range test.steps {
+				// A line the server rejects may be cut off part way through.
+				if _, err := io.WriteString(conn, step.send); err != nil && step.want != nil {
+					t.Fatalf("writing %q - %v", step.send, err)
+				}
+				for _, want := range step.want {
+					got, err := reader.ReadString('\n')
+					if err != nil {
+						t.Fatalf("after %q, reading %q - %v", step.send, want, err)
+					}
+					if got != want+"\n" {
+						t.Fatalf("after %q, got %q, want %q", step.send, got, want+"\n")
+					}
+				}
+			}
+			// Every conversation ends with the server closing the connection.
+			if line, err := reader.ReadString('\n'); err != io.EOF {
+				t.Fatalf("got %q, %v, want the connection closed", line, err)
+			}
+		})
+	}
+}
+
+func TestServeLegacyWithoutASCIIAnswers(t *testing.T) {
+	server := newTestServer(t, WithAlphabet(protocol.AlphabetGerman), WithWords([]string{"\u00e4pfel", "stra\u00dfe"}))
+	if err := server.ServeLegacy(newPipeListener()); err != errLegacyAnswers {
+		t.Fatalf("ServeLegacy() = %v, want %v", err, errLegacyAnswers)
+	}
+}
@@ -0,0 +1,180 @@
+package hangmango
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// clientManager ... struct that maintains
+// connected clients and channels for connection and disconnnection
+type clientManager struct {
+	clients    map[*client]bool
+	register   chan *client
+	unregister chan *client
+	// shutdown is closed to ask the manager to disconnect every client, done is
+	// closed by the manager once the last client has unregistered.
+	shutdown chan struct{}
+	done     chan struct{}
+	logger   *log.Logger
+}
+
+// client ... struct that represents a client socket, the data channel
+// to send and receive information on, the protocol session protecting
+// that data, the identity from the client's certificate if it authenticated
+// and currently unused state & guid
+type client struct {
+	server   *Server
+	socket   net.Conn
+	identity string
+	data     chan []byte
+	done     chan struct{}
+	// stop is closed by the manager when the client is unregistered. The data channel is
+	// never closed, as a race opponent may still be sending to it.
+	stop     chan struct{}
+	codec    *protocol.Codec
+	session  *protocol.Session
+	state    HangmanState
+	guid     string
+	gameHash []byte
+	// closing is set once an ERROR or the SUMMARY ending the session has been queued, after
+	// which frames from the client are ignored.
+	closing bool
+	// rounds holds the result of every game finished on this connection and total the sum
+	// of their scores.
+	rounds []protocol.RoundResult
+	total  int
+
+	// mu is held while a frame from the client is handled, and by a race opponent updating
+	// the client's game. sendMu keeps frames queued on data in the order they were sealed.
+	mu     sync.Mutex
+	sendMu sync.Mutex
+	// race is the race the client is playing, waiting is set while it's queued for one and
+	// removed once it has disconnected. notify holds work for the opponent, which is run once
+	// mu has been released so two players can't deadlock.
+	race    *race
+	waiting bool
+	removed bool
+	notify  []func()
+}
+
+// start ... handle connection and disconnection of clients
+// from the clientManager.
+func (manager *clientManager) start() {
+	defer close(manager.done)
+	shutdown := manager.shutdown
+	for {
+		select {
+		case connection := <-manager.register:
+			manager.clients[connection] = true
+			manager.logger.Printf("- Client connected from %v", connection.socket.RemoteAddr())
+			// TODO: timeout the connection
+
+		case connection := <-manager.unregister:
+			if _, ok := manager.clients[connection]; ok {
+				close(connection.stop)
+				delete(manager.clients, connection)
+			}
+			manager.logger.Printf("- Client disconnected from %v", connection.socket.RemoteAddr())
+
+		case <-shutdown:
+			// Closing the sockets makes each receiveData goroutine unregister its client.
+			for connection := range manager.clients {
+				connection.socket.Close()
+			}
+			shutdown = nil
+		}
+		if shutdown == nil && len(manager.clients) == 0 {
+			return
+		}
+	}
+}
+
+// add ... registers client with the manager, returning false if the manager has stopped.
+func (manager *clientManager) add(client *client) bool {
+	select {
+	case manager.register <- client:
+		return true
+	case <-manager.done:
+		return false
+	}
+}
+
+// remove ... unregisters client from the manager.
+func (manager *clientManager) remove(client *client) {
+	select {
+	case manager.unregister <- client:
+	case <-manager.done:
+	}
+}
+
+// sendData ... send data to specified client within the context of the
+// current clientManager. Each message is written to the socket as a single
+// length-prefixed frame.
+func (manager *clientManager) sendData(client *client) {
+	defer close(client.done)
+	defer client.socket.Close()
+	for {
+		select {
+		case message, ok := <-client.data:
+			// If the data channel is not OK, return, handle an error first. A nil frame
+			// asks for the connection to be closed once everything before it is written.
+			if !ok || message == nil {
+				return
+			}
+			err := client.codec.WriteFrame(message)
+			if err != nil {
+				manager.logger.Printf("- ERROR - TO - %s - %s", client.socket.RemoteAddr().String(), err)
+				return
+			}
+		case <-client.stop:
+			return
+		}
+	}
+}
+
+// receiveData ... listen for incoming frames per client and pass each complete
+// frame to receiverLogic(). Frames larger than the maximum frame size are rejected
+// before they are read into memory, and any framing violation is treated as a
+// protocol error that closes the connection.
+func (manager *clientManager) receiveData(client *client) {
+	// Complete the TLS handshake up front so a verified client certificate can be recorded.
+	if tlsConn, ok := client.socket.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err != nil {
+			manager.logger.Printf("- CRYPTO - FROM - %s - TLS handshake failed - %s", client.socket.RemoteAddr().String(), err)
+			manager.remove(client)
+			client.socket.Close()
+			return
+		}
+		if certificates := tlsConn.ConnectionState().PeerCertificates; len(certificates) > 0 {
+			client.identity = certificates[0].Subject.CommonName
+			manager.logger.Printf("- AUTH - FROM - %s - Client authenticated as %q", client.socket.RemoteAddr().String(), client.identity)
+		}
+	}
+	for {
+		frame, err := client.codec.ReadFrame()
+		if err != nil {
+			if _, ok := err.(*protocol.ProtocolError); ok {
+				manager.logger.Printf("- PROTOCOL - FROM - %s - %s, connection closed", client.socket.RemoteAddr().String(), err)
+				client.fail(protocol.ErrorProtocol, err.Error())
+			} else if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				manager.logger.Printf("- ERROR - FROM - %s - %s", client.socket.RemoteAddr().String(), err)
+			}
+			client.server.leaveRace(client)
+			manager.remove(client)
+			client.socket.Close()
+			break
+		}
+		client.server.receiverLogic(client, frame)
+		if client.closing {
+			client.server.leaveRace(client)
+			manager.remove(client)
+			break
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package hangmango
+
+// race contains head-to-head race mode. A client asking for a race in START GAME or NEW GAME
+// is queued until another client asks for the same settings, then both are given the same
+// answer to guess independently. The first to solve it wins and the other is beaten, and
+// each player is sent an OPPONENT message whenever the other guesses.
+//
+// Both players' games are changed from either player's goroutine, so a client's mu is held
+// while its frames are handled and while its opponent updates its game. Locks are always
+// taken client first and then race, and a client never locks its opponent while holding its
+// own mu, anything that must happen to the opponent is queued on notify instead.
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// matchmaker ... clients waiting for an opponent, by the settings they asked for.
+type matchmaker struct {
+	mu      sync.Mutex
+	waiting map[protocol.GameSettings]*client
+}
+
+// racer ... a player's progress in a race, as shared with their opponent.
+type racer struct {
+	client   *client
+	name     string
+	revealed int
+	lives    int
+	outcome  protocol.Outcome
+	score    int
+	left     bool
+}
+
+// race ... two players guessing the same answer. over is set once neither can still win.
+type race struct {
+	mu       sync.Mutex
+	answer   string
+	letters  int
+	settings protocol.GameSettings
+	racers   [2]racer
+	over     bool
+}
+
+// index ... returns the position of p in the race's racers.
+func (r *race) index(p *client) int {
+	if r.racers[0].client == p {
+		return 0
+	}
+	return 1
+}
+
+// opponentStatus ... returns the progress of the i'th racer to send to their opponent, the
+// caller must hold r.mu.
+func (r *race) opponentStatus(i int) *protocol.OpponentStatus {
+	player := r.racers[i]
+	return &protocol.OpponentStatus{
+		Name:     player.name,
+		Revealed: player.revealed,
+		Letters:  r.letters,
+		Lives:    player.lives,
+		MaxLives: r.settings.Lives,
+		Out:      player.outcome == protocol.OutcomeLost,
+		Left:     player.left,
+	}
+}
+
+// joinRace ... pairs client with a client waiting for the same settings, or queues it until
+// another one asks for them. The caller must hold client.mu.
+func (server *Server) joinRace(client *client, settings protocol.GameSettings, pool []string) {
+	server.matchmaker.mu.Lock()
+	opponent := server.matchmaker.waiting[settings]
+	if opponent == nil {
+		server.matchmaker.waiting[settings] = client
+		server.matchmaker.mu.Unlock()
+		client.waiting = true
+		server.logger.Printf("- HANGMAN - FROM - %s - Waiting for an opponent with %v", client.socket.RemoteAddr().String(), settings)
+		return
+	}
+	delete(server.matchmaker.waiting, settings)
+	server.matchmaker.mu.Unlock()
+
+	r := &race{answer: pool[rand.Intn(len(pool))], settings: settings}
+	r.letters = countLetters(r.answer)
+	r.racers[0] = racer{client: opponent, name: opponent.identity, lives: settings.Lives}
+	r.racers[1] = racer{client: client, name: client.identity, lives: settings.Lives}
+	server.logger.Printf("- HANGMAN - Race started between %s and %s", opponent.socket.RemoteAddr().String(), client.socket.RemoteAddr().String())
+	client.race = r
+	server.startRaceGame(client, r)
+	client.notify = append(client.notify, func() { server.joinWaiting(opponent, r) })
+}
+
+// joinWaiting ... starts the race for the client that was waiting for it, or forfeits it
+// for them if they disconnected while it was being set up.
+func (server *Server) joinWaiting(waiting *client, r *race) {
+	waiting.mu.Lock()
+	if waiting.removed {
+		waiting.mu.Unlock()
+		server.forfeit(r, waiting)
+		return
+	}
+	waiting.waiting = false
+	waiting.race = r
+	server.startRaceGame(waiting, r)
+	waiting.mu.Unlock()
+}
+
+// startRaceGame ... creates p's game with the race's answer and sends the first hint, then
+// an OPPONENT message introducing their opponent. The caller must hold p.mu.
+func (server *Server) startRaceGame(p *client, r *race) {
+	server.newGame(p, []string{r.answer}, r.settings.Lives)
+	p.generateGameHash()
+	status := p.state.status()
+	status.Alphabet = &server.alphabet
+	settings := r.settings
+	p.send(protocol.Message{Content: []byte(p.state.hint), Hash: p.gameHash, Status: status, Settings: &settings})
+	p.session.SetGameHash(p.gameHash)
+
+	r.mu.Lock()
+	opponent := r.opponentStatus(1 - r.index(p))
+	r.mu.Unlock()
+	p.send(protocol.Message{Mtype: protocol.KindOpponent, Opponent: opponent})
+}
+
+// raceGuess ... plays a validated guess in client's race and shares their progress with
+// the opponent. The caller must hold client.mu.
+func (server *Server) raceGuess(client *client, guess string) {
+	r := client.race
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.over {
+		// The opponent has won, the GAME OVER saying so is on its way.
+		return
+	}
+	i := r.index(client)
+	player, opponent := &r.racers[i], &r.racers[1-i]
+
+	client.state.process(guess)
+	if client.state.repeated {
+		client.send(protocol.Message{Mtype: protocol.KindAlreadyGuessed, Content: []byte(strings.ToLower(guess)), Status: client.state.status()})
+		return
+	}
+	player.lives = client.state.lives
+	player.revealed = countLetters(client.state.hint)
+	switch client.state.outcome {
+	case protocol.OutcomeWon:
+		player.outcome, player.score = protocol.OutcomeWon, client.state.score
+		player.revealed = r.letters
+		if opponent.outcome == "" {
+			opponent.outcome = protocol.OutcomeBeaten
+		}
+		r.over = true
+	case protocol.OutcomeLost:
+		// The game isn't over until the opponent has finished too.
+		player.outcome = protocol.OutcomeLost
+		client.send(protocol.Message{Content: []byte(client.state.hint), Status: client.state.status()})
+		r.over = opponent.outcome != ""
+	default:
+		client.send(protocol.Message{Content: []byte(client.state.hint), Status: client.state.status()})
+	}
+	if opponent.left {
+		if r.over {
+			server.endRace(client, r)
+		}
+		return
+	}
+	opponent.client.send(protocol.Message{Mtype: protocol.KindOpponent, Opponent: r.opponentStatus(i)})
+	if r.over {
+		server.endRace(client, r)
+		other := opponent.client
+		client.notify = append(client.notify, func() { server.finishRace(other, r) })
+	}
+}
+
+// finishRace ... ends p's game in a race that's over, after their opponent won or left.
+func (server *Server) finishRace(p *client, r *race) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if p.race != r {
+		return
+	}
+	if p.state.valid {
+		p.state.valid = false
+		p.state.outcome = protocol.OutcomeBeaten
+		p.state.score = 0
+	}
+	server.endRace(p, r)
+}
+
+// endRace ... records p's game and sends them GAME OVER with how their opponent did. The
+// caller must hold p.mu and r.mu.
+func (server *Server) endRace(p *client, r *race) {
+	p.recordRound()
+	opponent := r.racers[1-r.index(p)]
+	result := &protocol.GameResult{
+		Outcome: p.state.outcome,
+		Answer:  p.state.answer,
+		Scoring: p.state.scorer.Name(),
+		Round:   len(p.rounds),
+		Total:   p.total,
+		Race:    &protocol.RaceResult{Opponent: opponent.name, Outcome: opponent.outcome, Score: opponent.score},
+	}
+	p.send(protocol.Message{Mtype: protocol.KindGameOver, Content: []byte(fmt.Sprintf("%d", p.state.score)), Result: result})
+	p.race = nil
+}
+
+// leaveRace ... takes a disconnected client out of the queue or the race it's playing.
+func (server *Server) leaveRace(client *client) {
+	server.matchmaker.mu.Lock()
+	for settings, waiting := range server.matchmaker.waiting {
+		if waiting == client {
+			delete(server.matchmaker.waiting, settings)
+		}
+	}
+	server.matchmaker.mu.Unlock()
+
+	client.mu.Lock()
+	client.removed = true
+	r := client.race
+	client.race = nil
+	client.mu.Unlock()
+	if r != nil {
+		server.forfeit(r, client)
+	}
+}
+
+// forfeit ... tells p's opponent they've left, which ends the race if the opponent was
+// the only one still playing. The caller must not hold any locks.
+func (server *Server) forfeit(r *race, p *client) {
+	r.mu.Lock()
+	if r.over {
+		r.mu.Unlock()
+		return
+	}
+	i := r.index(p)
+	player, opponent := &r.racers[i], r.racers[1-i]
+	player.left = true
+	if player.outcome == "" {
+		player.outcome = protocol.OutcomeForfeit
+	}
+	r.over = opponent.outcome != ""
+	status := r.opponentStatus(i)
+	over := r.over
+	r.mu.Unlock()
+
+	server.logger.Printf("- HANGMAN - FROM - %s - Left a race", p.socket.RemoteAddr().String())
+	opponent.client.send(protocol.Message{Mtype: protocol.KindOpponent, Opponent: status})
+	if over {
+		server.finishRace(opponent.client, r)
+	}
+}
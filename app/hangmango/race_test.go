@@ -0,0 +1,136 @@
+package hangmango
+
+import (
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// raceStep ... a guess by, or the departure of, one of the two players in a race, and the
+// kinds of message each player receives as a result.
+type raceStep struct {
+	player int
+	guess  string
+	leave  bool
+	want   [2][]protocol.Kind
+}
+
+func TestRace(t *testing.T) {
+	var (
+		hint     = []protocol.Kind{protocol.KindHangman}
+		opponent = []protocol.Kind{protocol.KindOpponent}
+		gameOver = []protocol.Kind{protocol.KindGameOver}
+	)
+	tests := []struct {
+		name  string
+		steps []raceStep
+		// wantOutcome is each player's outcome in their GAME OVER and wantOpponent is the
+		// outcome it reports for their opponent, both are empty for a player who left.
+		wantOutcome  [2]protocol.Outcome
+		wantOpponent [2]protocol.Outcome
+	}{
+		{
+			name: "won and beaten",
+			steps: []raceStep{
+				{player: 0, guess: "apple", want: [2][]protocol.Kind{gameOver, {protocol.KindOpponent, protocol.KindGameOver}}},
+			},
+			wantOutcome:  [2]protocol.Outcome{protocol.OutcomeWon, protocol.OutcomeBeaten},
+			wantOpponent: [2]protocol.Outcome{protocol.OutcomeBeaten, protocol.OutcomeWon},
+		},
+		{
+			name: "lost, then the opponent finishes",
+			steps: []raceStep{
+				{player: 0, guess: "x", want: [2][]protocol.Kind{hint, opponent}},
+				{player: 1, guess: "apple", want: [2][]protocol.Kind{{protocol.KindOpponent, protocol.KindGameOver}, gameOver}},
+			},
+			wantOutcome:  [2]protocol.Outcome{protocol.OutcomeLost, protocol.OutcomeWon},
+			wantOpponent: [2]protocol.Outcome{protocol.OutcomeWon, protocol.OutcomeLost},
+		},
+		{
+			name: "both lost",
+			steps: []raceStep{
+				{player: 0, guess: "x", want: [2][]protocol.Kind{hint, opponent}},
+				{player: 1, guess: "x", want: [2][]protocol.Kind{{protocol.KindOpponent, protocol.KindGameOver}, {protocol.KindHangman, protocol.KindGameOver}}},
+			},
+			wantOutcome:  [2]protocol.Outcome{protocol.OutcomeLost, protocol.OutcomeLost},
+			wantOpponent: [2]protocol.Outcome{protocol.OutcomeLost, protocol.OutcomeLost},
+		},
+		{
+			name: "forfeit on leave",
+			steps: []raceStep{
+				{player: 0, leave: true, want: [2][]protocol.Kind{nil, opponent}},
+				{player: 1, guess: "apple", want: [2][]protocol.Kind{nil, gameOver}},
+			},
+			wantOutcome:  [2]protocol.Outcome{"", protocol.OutcomeWon},
+			wantOpponent: [2]protocol.Outcome{"", protocol.OutcomeForfeit},
+		},
+		{
+			name: "forfeit on leave after the opponent lost",
+			steps: []raceStep{
+				{player: 0, guess: "x", want: [2][]protocol.Kind{hint, opponent}},
+				{player: 1, leave: true, want: [2][]protocol.Kind{{protocol.KindOpponent, protocol.KindGameOver}, nil}},
+			},
+			wantOutcome:  [2]protocol.Outcome{protocol.OutcomeLost, ""},
+			wantOpponent: [2]protocol.Outcome{protocol.OutcomeForfeit, ""},
+		},
+		{
+			name: "leave after losing",
+			steps: []raceStep{
+				{player: 0, guess: "x", want: [2][]protocol.Kind{hint, opponent}},
+				{player: 0, leave: true, want: [2][]protocol.Kind{nil, opponent}},
+				{player: 1, guess: "apple", want: [2][]protocol.Kind{nil, gameOver}},
+			},
+			wantOutcome:  [2]protocol.Outcome{"", protocol.OutcomeWon},
+			wantOpponent: [2]protocol.Outcome{"", protocol.OutcomeLost},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, WithWords([]string{"apple"}), WithLives(1))
+			listener := newPipeListener()
+			go server.Serve(listener)
+
+			// The first player waits for the second, then both are sent the first hint
+			// and their opponent.
+			var players [2]*testClient
+			for i := range players {
+				players[i] = newTestClient(t, listener, protocol.FeatureRounds, protocol.FeatureRace)
+				players[i].send(protocol.Message{Content: []byte(protocol.StartGame), Settings: &protocol.GameSettings{Race: true}})
+			}
+			for _, player := range players {
+				player.expect(protocol.KindHangman)
+				player.expect(protocol.KindOpponent)
+			}
+
+			var results [2]*protocol.GameResult
+			for _, step := range test.steps {
+				if step.leave {
+					players[step.player].leave()
+				} else {
+					players[step.player].guess(step.guess)
+				}
+				for i, kinds := range step.want {
+					for _, kind := range kinds {
+						if message := players[i].expect(kind); kind == protocol.KindGameOver {
+							results[i] = message.Result
+						}
+					}
+				}
+			}
+			for i, result := range results {
+				if test.wantOutcome[i] == "" {
+					continue
+				}
+				if result == nil || result.Race == nil {
+					t.Fatalf("player %d GAME OVER result = %v, want a race result", i, result)
+				}
+				if result.Outcome != test.wantOutcome[i] {
+					t.Errorf("player %d outcome = %q, want %q", i, result.Outcome, test.wantOutcome[i])
+				}
+				if result.Race.Outcome != test.wantOpponent[i] {
+					t.Errorf("player %d opponent outcome = %q, want %q", i, result.Race.Outcome, test.wantOpponent[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,474 @@
+package hangmango
+
+// receivelogic contains methods called from the receiveData() function in manager.go
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// suiteMessages ... handshake messages and the suite they belong to.
+var suiteMessages = map[protocol.Kind]protocol.Suite{
+	protocol.KindPubKeyReq: protocol.SuiteRSA,
+	protocol.KindSymKeyReq: protocol.SuiteRSA,
+	protocol.KindECDHEReq:  protocol.SuiteECDHE,
+}
+
+// receiverLogic ... handles a single frame received from the client, holding client.mu so
+// a race opponent can't change the client's game at the same time.
+func (server *Server) receiverLogic(client *client, frame []byte) {
+	client.mu.Lock()
+	defer client.deliver()
+	defer client.mu.Unlock()
+	length := len(frame)
+	// If the message is valid in length, format, etc, then we can parse it.
+	if length > 0 {
+
+		// The session handles both cases; where the message is encrypted and we parse out the underlying
+		// hangman protocol or it's not encrypted yet because it's still a handshake and we parse it as is.
+		message, err := client.session.Open(frame)
+		if err != nil {
+			server.logger.Printf("- ERROR - FROM - %s - %s", client.socket.RemoteAddr().String(), err)
+			// A message that can't be opened means the session can't be trusted.
+			client.fail(protocol.ErrorCodeFor(err), err.Error())
+			return
+		}
+
+		// HELLO picks the version of the protocol the rest of the connection is handled with.
+		if message.Mtype == protocol.KindHello {
+			server.handleHello(client, message)
+			return
+		}
+		switch client.session.Version() {
+		case protocol.Version1:
+			server.receiveVersion1(client, message, length)
+		default:
+			server.logger.Printf("- PROTOCOL - FROM - %s - %s received before HELLO, connection closed", client.socket.RemoteAddr().String(), message.Mtype)
+			client.fail(protocol.ErrorNegotiation, "HELLO must be the first message sent")
+		}
+	}
+}
+
+// receiveVersion1 ... handles a message from a client that negotiated version 1 of the protocol.
+func (server *Server) receiveVersion1(client *client, message protocol.Message, length int) {
+	// Determine whether the message is a guess in a game, or part of encryption establishment.
+	server.logger.Printf("- FROM - %s - EL:%d - %s", client.socket.RemoteAddr().String(), length, fmt.Sprintf("%s", message))
+	if client.state.valid && message.Mtype == protocol.KindHangman && len(message.Content) > 0 {
+		// Letters may have been typed with combining marks, which the answer never contains.
+		message.Content = []byte(protocol.Normalize(string(message.Content)))
+		// Check if a hash was sent in the message, if it was, compare it against the servers known.
+		// If it doesn't something has gone wrong and we kill? the game.
+		if len(message.Hash) > 0 && bytes.Equal(message.Hash, client.gameHash) {
+			server.logger.Printf("- GAMEHASH - Gamehash sent from the client matched the server, we're proceeding - %v - %v", message.Hash, client.gameHash)
+		} else if len(message.Hash) > 0 && !bytes.Equal(message.Hash, client.gameHash) {
+			server.logger.Printf("- GAMEHASH - Gamehash sent from the client is wrong, something went awry, killing the game.. - %v - %v", message.Hash, client.gameHash)
+			client.fail(protocol.ErrorGameHash, "game hash doesn't match the game in progress")
+			return
+		}
+		// Only guesses the protocol permits reach the game, anything else is rejected.
+		if err := validateGuess(message.Content, server.alphabet); err != nil {
+			server.rejectGuess(client, err)
+			return
+		}
+		if client.race != nil {
+			server.raceGuess(client, string(message.Content))
+			return
+		}
+		// Pass the plaintext message off to hangman to process it
+		hangmanResponse := client.state.process(string(message.Content))
+		// If the last call to state.process set valid to false, we know the game is over and can
+		// send a followup message to the client indicating so. Otherwise keep playing the game.
+		if !client.state.valid {
+			server.handleGameOver(client, hangmanResponse)
+		} else if client.state.repeated {
+			client.send(protocol.Message{Mtype: protocol.KindAlreadyGuessed, Content: bytes.ToLower(message.Content), Status: client.state.status()})
+		} else {
+			client.send(protocol.Message{Content: []byte(hangmanResponse), Status: client.state.status()})
+		}
+	} else if client.session.SecureTransport() && message.Mtype != protocol.KindHangman && message.Mtype != protocol.KindNewGame && message.Mtype != protocol.KindQuit {
+		// The transport is already protected, so there's no handshake to perform.
+		server.logger.Printf("- FROM - %s - Ignoring %s over a secure transport", client.socket.RemoteAddr().String(), message.Mtype)
+	} else {
+		// Handshake messages must belong to the suite and features chosen in HELLO.
+		hello, _ := client.session.Negotiated()
+		if suite, ok := suiteMessages[message.Mtype]; ok && suite != hello.Suite() {
+			server.logger.Printf("- PROTOCOL - FROM - %s - %s isn't part of the negotiated suite %s, connection closed", client.socket.RemoteAddr().String(), message.Mtype, hello.Suite())
+			client.fail(protocol.ErrorProtocol, fmt.Sprintf("%s isn't part of the negotiated suite %s", message.Mtype, hello.Suite()))
+			return
+		}
+		if (message.Mtype == protocol.KindNewGame || message.Mtype == protocol.KindQuit) && !hello.Has(protocol.FeatureRounds) {
+			server.logger.Printf("- PROTOCOL - FROM - %s - %s received without negotiating %s, connection closed", client.socket.RemoteAddr().String(), message.Mtype, protocol.FeatureRounds)
+			client.fail(protocol.ErrorProtocol, fmt.Sprintf("%s wasn't negotiated", protocol.FeatureRounds))
+			return
+		}
+		if message.Mtype == protocol.KindClientAuth && !hello.Has(protocol.FeatureClientAuth) {
+			server.logger.Printf("- PROTOCOL - FROM - %s - CLIENTAUTH received without negotiating %s, connection closed", client.socket.RemoteAddr().String(), protocol.FeatureClientAuth)
+			client.fail(protocol.ErrorProtocol, "client authentication wasn't negotiated")
+			return
+		}
+		// Handle a PUBKEYREQ message
+		if message.Mtype == protocol.KindPubKeyReq {
+			server.handlePubKeyReq(client, message)
+		}
+		if message.Mtype == protocol.KindSymKeyReq {
+			server.handleSymKeyReq(client)
+		}
+		if message.Mtype == protocol.KindECDHEReq {
+			server.handleECDHEReq(client, message)
+		}
+		if message.Mtype == protocol.KindClientAuth {
+			server.handleClientAuth(client, message)
+		}
+		if message.Mtype == protocol.KindQuit {
+			server.handleQuit(client)
+		}
+		// Make a new game for the client once the session is established
+		if (message.Mtype == protocol.KindHangman && bytes.Equal(message.Content, []byte(protocol.StartGame))) || message.Mtype == protocol.KindNewGame {
+			if !client.session.Established() {
+				server.logger.Printf("- FROM - %s - START GAME received before a session key was established, ignoring", client.socket.RemoteAddr().String())
+				return
+			}
+			if server.requireClientAuth && client.identity == "" {
+				server.logger.Printf("- AUTH - FROM - %s - START GAME received from an unauthenticated client, connection closed", client.socket.RemoteAddr().String())
+				client.fail(protocol.ErrorUnauthenticated, "client authentication is required before START GAME")
+				return
+			}
+			if client.state.valid || client.race != nil || client.waiting {
+				server.logger.Printf("- HANGMAN - FROM - %s - NEW GAME received while a game is in progress, rejected", client.socket.RemoteAddr().String())
+				client.send(protocol.Message{Mtype: protocol.KindRejected, Code: protocol.ErrorProtocol, Content: []byte("a game is already in progress")})
+				return
+			}
+			server.handleStartGameReq(client, message.Settings)
+		}
+	}
+}
+
+// Handler functions for various messages
+
+// handleHello ... replies to the client's HELLO with the protocol version, suite and features
+// the connection will use, signed with the keys for the certificate the client holds.
+// Clients we share no version or suite with, or that can't authenticate when the server
+// requires it, are sent an ERROR and disconnected.
+func (server *Server) handleHello(client *client, message protocol.Message) {
+	if _, ok := client.session.Negotiated(); ok {
+		server.logger.Printf("- PROTOCOL - FROM - %s - HELLO received twice, connection closed", client.socket.RemoteAddr().String())
+		client.fail(protocol.ErrorProtocol, "HELLO was already sent")
+		return
+	}
+	var offer protocol.Hello
+	if message.Hello != nil {
+		offer = *message.Hello
+	}
+	selected, err := protocol.Negotiate(offer, server.supportedHello(client))
+	if err != nil {
+		server.logger.Printf("- PROTOCOL - FROM - %s - %s, connection closed", client.socket.RemoteAddr().String(), err)
+		client.fail(protocol.ErrorCodeFor(err), err.Error())
+		return
+	}
+	if server.requireClientAuth && !client.session.SecureTransport() && !selected.Has(protocol.FeatureClientAuth) {
+		server.logger.Printf("- AUTH - FROM - %s - Client doesn't support client authentication, connection closed", client.socket.RemoteAddr().String())
+		client.fail(protocol.ErrorUnauthenticated, "client authentication is required")
+		return
+	}
+	reply := protocol.Message{Mtype: protocol.KindHello, Hello: &selected}
+	if !client.session.SecureTransport() {
+		keys := server.useKeysFor(client, message.KeyID)
+		reply.KeyID, reply.Certificate = keys.id, keys.certificate
+	}
+	client.send(reply)
+	client.session.SetNegotiated(selected)
+	server.logger.Printf("- PROTOCOL - FROM - %s - Negotiated version %d, suite %q, features %v", client.socket.RemoteAddr().String(), selected.Version(), selected.Suite(), selected.Features)
+}
+
+// supportedHello ... returns the versions, suites and features the server supports for
+// client, in the server's order of preference.
+func (server *Server) supportedHello(client *client) protocol.Hello {
+	supported := protocol.Hello{
+		Versions: protocol.SupportedVersions,
+		Features: []protocol.Feature{protocol.FeatureRekey, protocol.FeatureRounds, protocol.FeatureRace},
+	}
+	// Over a secure transport there's no handshake, so no suite and no CLIENTAUTH.
+	if !client.session.SecureTransport() {
+		supported.Suites = []protocol.Suite{protocol.SuiteECDHE, protocol.SuiteRSA}
+		if server.clientCAs != nil {
+			supported.Features = append(supported.Features, protocol.FeatureClientAuth)
+		}
+	}
+	return supported
+}
+
+// handlePubKeyReq ... executes the logic required of the server
+// when a client sent a REQPUBKEY message. The result is sent on the
+// data channel as a slice of bytes to the client passed to the function
+func (server *Server) handlePubKeyReq(client *client, message protocol.Message) {
+	var clientPubKey rsa.PublicKey
+	err := json.Unmarshal(message.Content, &clientPubKey)
+	if err != nil {
+		server.logger.Printf("- ERROR - Deserialisation error - %s\n", err)
+	} else {
+		// provide our public key, signed but not encrypted, then encrypt everything that follows
+		keys := server.useKeysFor(client, message.KeyID)
+		client.send(protocol.Message{Mtype: protocol.KindPubKeyResp, Content: keys.encryptionKeyJSON, KeyID: keys.id, Certificate: keys.certificate})
+		client.session.EnableEncryption(&clientPubKey)
+	}
+}
+
+// handleSymKeyReq ... generates a key for AEAD GCM encryption
+// and shares it back to the client with a message that's encrypted using said key.
+func (server *Server) handleSymKeyReq(client *client) {
+	// The key is only protected once PUBKEYREQ has given us the client's public key, and
+	// replacing it part way through a session would reset the sequence numbers.
+	if !client.session.Encrypted() || client.session.Established() {
+		server.logger.Printf("- CRYPTO - FROM - %s - SYMKEYREQ received before PUBKEYREQ or after the session was established, ignoring", client.socket.RemoteAddr().String())
+		return
+	}
+	AEADKey, err := protocol.GenerateSymmetricKey()
+	if err != nil {
+		server.logger.Printf("- CRYPTO - %s", err)
+		return
+	}
+
+	client.send(protocol.Message{Mtype: protocol.KindSymKeyResp, Content: AEADKey})
+	// Now that the sym key has been sent off to client, we set the session's
+	// symmetric key so that future decryption occurs using it.
+	if err := client.session.SetSymmetricKey(AEADKey); err != nil {
+		server.logger.Printf("- CRYPTO - %s", err)
+		client.fail(protocol.ErrorInternal, "failed to establish the session key")
+	}
+}
+
+// handleECDHEReq ... completes an ephemeral X25519 key agreement with the client's key share.
+// Our share is returned alongside a signature over both shares so the client knows it was
+// generated by the holder of the certificate key, then the derived key becomes the session key.
+func (server *Server) handleECDHEReq(client *client, message protocol.Message) {
+	if client.session.Encrypted() {
+		server.logger.Printf("- CRYPTO - FROM - %s - ECDHEREQ received after the session was established, ignoring", client.socket.RemoteAddr().String())
+		return
+	}
+	ecdheKey, err := protocol.GenerateECDHEKey()
+	if err != nil {
+		server.logger.Printf("- CRYPTO - %s", err)
+		return
+	}
+	serverShare := ecdheKey.PublicKey().Bytes()
+	AEADKey, err := protocol.DeriveECDHESessionKey(ecdheKey, message.Content, serverShare)
+	if err != nil {
+		server.logger.Printf("- CRYPTO - FROM - %s - invalid ECDHE key share - %s", client.socket.RemoteAddr().String(), err)
+		return
+	}
+	keys := server.useKeysFor(client, message.KeyID)
+	signature, err := protocol.SignECDHEShares(message.Content, serverShare, keys.signingKey)
+	if err != nil {
+		server.logger.Printf("- CRYPTO - %s", err)
+		return
+	}
+
+	client.send(protocol.Message{Mtype: protocol.KindECDHEResp, Content: serverShare, Signature: signature, KeyID: keys.id, Certificate: keys.certificate})
+	if err := client.session.SetSymmetricKey(AEADKey); err != nil {
+		server.logger.Printf("- CRYPTO - %s", err)
+		client.fail(protocol.ErrorInternal, "failed to establish the session key")
+	}
+}
+
+// useKeysFor ... switches the client's session to the keys for the signing key the client
+// asked for by ID, or the current keys if those aren't available, and returns them.
+func (server *Server) useKeysFor(client *client, id string) *keySet {
+	keys := server.keysFor(id)
+	if id != "" && id != keys.id {
+		server.logger.Printf("- CRYPTO - FROM - %s - Client asked for key %s, using %s", client.socket.RemoteAddr().String(), id, keys.id)
+	}
+	client.session.SetServerKeys(keys.encryptionKey, keys.signingKey)
+	return keys
+}
+
+// handleClientAuth ... verifies the certificate a client presented against the client CAs
+// and its signature over the session's channel binding, which proves the client holds the
+// certificate's private key. On success the certificate's common name is recorded as the
+// identity of the client, a client presenting a certificate that fails verification is disconnected.
+func (server *Server) handleClientAuth(client *client, message protocol.Message) {
+	if server.clientCAs == nil {
+		server.logger.Printf("- AUTH - FROM - %s - Client authentication isn't enabled, ignoring CLIENTAUTH", client.socket.RemoteAddr().String())
+		return
+	}
+	binding := client.session.ChannelBinding()
+	if binding == nil || client.identity != "" {
+		server.logger.Printf("- AUTH - FROM - %s - Unexpected CLIENTAUTH, ignoring", client.socket.RemoteAddr().String())
+		return
+	}
+	identity, err := server.verifyClientCertificate(message.Content, message.Signature, binding)
+	if err != nil {
+		server.logger.Printf("- AUTH - FROM - %s - Client authentication failed, connection closed - %s", client.socket.RemoteAddr().String(), err)
+		client.fail(protocol.ErrorUnauthenticated, "client certificate wasn't accepted")
+		return
+	}
+	client.identity = identity
+	server.logger.Printf("- AUTH - FROM - %s - Client authenticated as %q", client.socket.RemoteAddr().String(), client.identity)
+}
+
+// verifyClientCertificate ... checks certificateDER chains to a client CA for client authentication
+// and that signature was made over binding with its key, returning the certificate's common name.
+func (server *Server) verifyClientCertificate(certificateDER []byte, signature []byte, binding []byte) (string, error) {
+	certificate, err := x509.ParseCertificate(certificateDER)
+	if err != nil {
+		return "", err
+	}
+	_, err = certificate.Verify(x509.VerifyOptions{
+		Roots:     server.clientCAs,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	if err != nil {
+		return "", err
+	}
+	publicKey, ok := certificate.PublicKey.(*rsa.PublicKey)
+	if !ok {
+		return "", errors.New("client certificate doesn't contain an RSA public key")
+	}
+	if err := protocol.Verify(binding, signature, publicKey); err != nil {
+		return "", err
+	}
+	if certificate.Subject.CommonName == "" {
+		return "", errors.New("client certificate has no common name")
+	}
+	return certificate.Subject.CommonName, nil
+}
+
+// handleStartGameReq ... executes the logic required of the server
+// when a client sent a START GAME message, with the settings it asked for if any.
+// The result is sent on the data channel as a slice of bytes to the client passed to the function
+func (server *Server) handleStartGameReq(client *client, requested *protocol.GameSettings) {
+	if hello, _ := client.session.Negotiated(); requested != nil && requested.Race && !hello.Has(protocol.FeatureRace) {
+		server.logger.Printf("- PROTOCOL - FROM - %s - Race requested without negotiating %s, connection closed", client.socket.RemoteAddr().String(), protocol.FeatureRace)
+		client.fail(protocol.ErrorProtocol, fmt.Sprintf("%s wasn't negotiated", protocol.FeatureRace))
+		return
+	}
+	settings, pool, err := server.resolveSettings(requested)
+	if err != nil {
+		server.logger.Printf("- HANGMAN - FROM - %s - Invalid game settings %v - %s, connection closed", client.socket.RemoteAddr().String(), requested, err)
+		client.fail(protocol.ErrorSettings, err.Error())
+		return
+	}
+	if settings.Race {
+		server.joinRace(client, settings, pool)
+		return
+	}
+	server.newGame(client, pool, settings.Lives)
+	client.generateGameHash()
+	// The first hint overloads the Hash field to share the game hash with the client.
+	// Every message after it, in both directions, is bound to the game hash. It also carries
+	// the alphabet, so the client can validate guesses with the same letters.
+	status := client.state.status()
+	status.Alphabet = &server.alphabet
+	hint := protocol.Message{Content: []byte(client.state.hint), Hash: client.gameHash, Status: status}
+	if requested != nil {
+		// Echo the settings the game was created with.
+		hint.Settings = &settings
+	}
+	client.send(hint)
+	client.session.SetGameHash(client.gameHash)
+}
+
+// newGame ... replaces the client's game with a new one using a word from pool, which can
+// be lost after lives wrong guesses.
+func (server *Server) newGame(client *client, pool []string, lives int) {
+	client.state = HangmanState{
+		turn:        false,
+		answer:      "",
+		guesses:     make([]string, 0),
+		wordguesses: make([]string, 0),
+		hint:        "",
+		valid:       true,
+		lives:       lives,
+		maxLives:    lives,
+		scorer:      server.scorer,
+	}
+	client.state.NewGame(pool)
+	if client.identity != "" {
+		server.logger.Printf("- HANGMAN - New game created for %q on this connection: %v", client.identity, client.state)
+	} else {
+		server.logger.Printf("- HANGMAN - New game created for this connection: %v", client.state)
+	}
+}
+
+// handleGameOver ... Generate a message with Mtype=GAME OVER, Content=score, the outcome of
+// the game, the name of the scoring strategy and the session's running total, encrypt and
+// add to channel. The answer is revealed so a losing client can check it.
+func (server *Server) handleGameOver(client *client, score string) {
+	client.recordRound()
+	result := &protocol.GameResult{
+		Outcome: client.state.outcome,
+		Answer:  client.state.answer,
+		Scoring: client.state.scorer.Name(),
+		Round:   len(client.rounds),
+		Total:   client.total,
+	}
+	client.send(protocol.Message{Mtype: protocol.KindGameOver, Content: []byte(score), Result: result})
+}
+
+// send ... seals msg with the clients session and adds it to the data channel, preceded
+// by a REKEY if the key we send with has reached its limits. A race opponent may send to
+// the client too, so frames are sealed and queued one at a time.
+func (client *client) send(msg protocol.Message) {
+	client.sendMu.Lock()
+	defer client.sendMu.Unlock()
+	if client.session.RekeyDue() {
+		frame, err := client.session.Rekey()
+		if err != nil {
+			client.server.logger.Printf("- CRYPTO - TO - %s - Failed to rekey, connection closed - %s", client.socket.RemoteAddr().String(), err)
+			client.socket.Close()
+			client.closing = true
+			return
+		}
+		select {
+		case client.data <- frame:
+			client.server.logger.Printf("- CRYPTO - TO - %s - Sent REKEY", client.socket.RemoteAddr().String())
+		case <-client.done:
+			return
+		}
+	}
+	frame, err := client.session.Seal(msg)
+	if err != nil {
+		client.server.logger.Printf("- ERROR - TO - %s - Output will not be passed on - %s", client.socket.RemoteAddr().String(), err)
+		return
+	}
+	// If the send goroutine has already exited the connection is closing and the message is dropped.
+	select {
+	case client.data <- frame:
+		client.server.logger.Printf("- TO - %s - PT:%s\n", client.socket.RemoteAddr().String(), fmt.Sprintf("%s", msg))
+	case <-client.done:
+	}
+}
+
+// fail ... sends the client an ERROR with code and reason and closes the connection once
+// it has been written. Frames received from the client afterwards are ignored.
+func (client *client) fail(code protocol.ErrorCode, reason string) {
+	client.closeWith(protocol.NewErrorMessage(code, reason))
+}
+
+// closeWith ... sends msg as the last message to the client and closes the connection once
+// it has been written. Frames received from the client afterwards are ignored.
+func (client *client) closeWith(msg protocol.Message) {
+	if client.closing {
+		return
+	}
+	client.closing = true
+	client.send(msg)
+	select {
+	case client.data <- nil:
+	case <-client.done:
+	}
+}
+
+// deliver ... runs the work queued on notify while client.mu was held, once it has been released.
+func (client *client) deliver() {
+	notify := client.notify
+	client.notify = nil
+	for _, f := range notify {
+		f()
+	}
+}
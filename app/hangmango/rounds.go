@@ -0,0 +1,26 @@
+package hangmango
+
+import "github.com/tgmars/hangmango/app/protocol"
+
+// recordRound ... adds the game that just ended to the client's round history and running total.
+func (client *client) recordRound() {
+	client.rounds = append(client.rounds, protocol.RoundResult{
+		Outcome: client.state.outcome,
+		Answer:  client.state.answer,
+		Score:   client.state.score,
+	})
+	client.total += client.state.score
+}
+
+// handleQuit ... ends the session when the client sends QUIT, replying with a SUMMARY of
+// every game finished on the connection before closing it. A game in progress is abandoned
+// and isn't included.
+func (server *Server) handleQuit(client *client) {
+	summary := &protocol.SessionSummary{Rounds: client.rounds, Total: client.total}
+	if client.identity != "" {
+		server.logger.Printf("- HANGMAN - FROM - %s - %q quit after %v", client.socket.RemoteAddr().String(), client.identity, summary)
+	} else {
+		server.logger.Printf("- HANGMAN - FROM - %s - Client quit after %v", client.socket.RemoteAddr().String(), summary)
+	}
+	client.closeWith(protocol.Message{Mtype: protocol.KindSummary, Summary: summary})
+}
@@ -0,0 +1,125 @@
+package hangmango
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// protocolStep ... a message sent by a test client and the kind and content of the reply it
+// expects, any content is accepted when wantContent is empty.
+type protocolStep struct {
+	send        protocol.Message
+	want        protocol.Kind
+	wantContent string
+}
+
+var (
+	startGame = protocol.Message{Content: []byte(protocol.StartGame)}
+	newGame   = protocol.Message{Mtype: protocol.KindNewGame}
+	quit      = protocol.Message{Mtype: protocol.KindQuit}
+)
+
+// guessMessage ... returns the message guessing guess.
+func guessMessage(guess string) protocol.Message {
+	return protocol.Message{Content: []byte(guess)}
+}
+
+func TestRounds(t *testing.T) {
+	tests := []struct {
+		name        string
+		features    []protocol.Feature
+		steps       []protocolStep
+		wantSummary *protocol.SessionSummary
+	}{
+		{
+			name:     "rounds totalled",
+			features: []protocol.Feature{protocol.FeatureRounds},
+			steps: []protocolStep{
+				{send: startGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("apple"), want: protocol.KindGameOver, wantContent: "49"},
+				{send: newGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("grape"), want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("apple"), want: protocol.KindGameOver, wantContent: "48"},
+				{send: quit, want: protocol.KindSummary},
+			},
+			wantSummary: &protocol.SessionSummary{
+				Rounds: []protocol.RoundResult{
+					{Outcome: protocol.OutcomeWon, Answer: "apple", Score: 49},
+					{Outcome: protocol.OutcomeWon, Answer: "apple", Score: 48},
+				},
+				Total: 97,
+			},
+		},
+		{
+			name:     "game in progress abandoned by QUIT",
+			features: []protocol.Feature{protocol.FeatureRounds},
+			steps: []protocolStep{
+				{send: startGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("apple"), want: protocol.KindGameOver, wantContent: "49"},
+				{send: newGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("p"), want: protocol.KindHangman, wantContent: "_pp__"},
+				{send: quit, want: protocol.KindSummary},
+			},
+			wantSummary: &protocol.SessionSummary{
+				Rounds: []protocol.RoundResult{{Outcome: protocol.OutcomeWon, Answer: "apple", Score: 49}},
+				Total:  49,
+			},
+		},
+		{
+			name:        "QUIT before a game",
+			features:    []protocol.Feature{protocol.FeatureRounds},
+			steps:       []protocolStep{{send: quit, want: protocol.KindSummary}},
+			wantSummary: &protocol.SessionSummary{},
+		},
+		{
+			name:     "NEW GAME during a game",
+			features: []protocol.Feature{protocol.FeatureRounds},
+			steps: []protocolStep{
+				{send: startGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: newGame, want: protocol.KindRejected},
+				{send: guessMessage("apple"), want: protocol.KindGameOver, wantContent: "49"},
+				{send: quit, want: protocol.KindSummary},
+			},
+			wantSummary: &protocol.SessionSummary{
+				Rounds: []protocol.RoundResult{{Outcome: protocol.OutcomeWon, Answer: "apple", Score: 49}},
+				Total:  49,
+			},
+		},
+		{
+			name: "NEW GAME without negotiating rounds",
+			steps: []protocolStep{
+				{send: startGame, want: protocol.KindHangman, wantContent: "_____"},
+				{send: guessMessage("apple"), want: protocol.KindGameOver, wantContent: "49"},
+				{send: newGame, want: protocol.KindError},
+			},
+		},
+		{
+			name:  "QUIT without negotiating rounds",
+			steps: []protocolStep{{send: quit, want: protocol.KindError}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newTestServer(t, WithWords([]string{"apple"}))
+			listener := newPipeListener()
+			go server.Serve(listener)
+			client := newTestClient(t, listener, test.features...)
+
+			var last protocol.Message
+			for _, step := range test.steps {
+				client.send(step.send)
+				last = client.expect(step.want)
+				if step.wantContent != "" && string(last.Content) != step.wantContent {
+					t.Fatalf("after %q %q, got %q, want %q", step.send.Mtype, step.send.Content, last.Content, step.wantContent)
+				}
+			}
+			if test.wantSummary != nil && !reflect.DeepEqual(last.Summary, test.wantSummary) {
+				t.Fatalf("SUMMARY = %+v, want %+v", last.Summary, test.wantSummary)
+			}
+			// QUIT and protocol errors both end the session.
+			client.expectClosed()
+		})
+	}
+}
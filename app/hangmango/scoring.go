@@ -0,0 +1,149 @@
+package hangmango
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+	"unicode"
+)
+
+// ScoredGame ... what a Scorer is told about a game the client won.
+type ScoredGame struct {
+	// Answer may be a phrase, only its letters count towards the score.
+	Answer string
+	// Guesses and WordGuesses hold every letter and word guessed, in order.
+	Guesses     []string
+	WordGuesses []string
+	// MissedLetters and MissedWords count the guesses that were wrong.
+	MissedLetters int
+	MissedWords   int
+	Duration      time.Duration
+}
+
+// Scorer ... calculates the score of a won game. Name identifies the strategy to clients,
+// which receive it with the score in GAME OVER. Lost games always score 0.
+type Scorer interface {
+	Name() string
+	Score(game ScoredGame) int
+}
+
+// DefaultScorer ... the scoring strategy used unless WithScorer is used.
+var DefaultScorer Scorer = OriginalScorer{}
+
+// OriginalScorer ... the formula from the original assessment criteria,
+// 10 * letters in the answer - 2 * letters guessed - words guessed. Every guess is
+// penalised, including correct letters, and the score can be negative.
+type OriginalScorer struct{}
+
+// Name ... returns "original".
+func (OriginalScorer) Name() string { return "original" }
+
+// Score ... implements Scorer.
+func (OriginalScorer) Score(game ScoredGame) int {
+	return 10*countLetters(game.Answer) - 2*len(game.Guesses) - len(game.WordGuesses)
+}
+
+// MissesScorer ... 10 * letters in the answer - 2 * wrong letters - wrong words,
+// so correct guesses cost nothing. Never less than 0.
+type MissesScorer struct{}
+
+// Name ... returns "misses".
+func (MissesScorer) Name() string { return "misses" }
+
+// Score ... implements Scorer.
+func (MissesScorer) Score(game ScoredGame) int {
+	return max(0, 10*countLetters(game.Answer)-2*game.MissedLetters-game.MissedWords)
+}
+
+// TimedScorer ... scores as MissesScorer less a point for every Interval the game took,
+// rewarding quick games. A zero Interval is treated as 10 seconds. Never less than 0.
+type TimedScorer struct {
+	Interval time.Duration
+}
+
+// Name ... returns "timed".
+func (TimedScorer) Name() string { return "timed" }
+
+// Score ... implements Scorer.
+func (scorer TimedScorer) Score(game ScoredGame) int {
+	interval := scorer.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	return max(0, MissesScorer{}.Score(game)-int(game.Duration/interval))
+}
+
+// letterValues ... how rarely each letter is used in English words, as valued in Scrabble.
+var letterValues = map[rune]int{
+	'a': 1, 'b': 3, 'c': 3, 'd': 2, 'e': 1, 'f': 4, 'g': 2, 'h': 4, 'i': 1, 'j': 8, 'k': 5, 'l': 1, 'm': 3,
+	'n': 1, 'o': 1, 'p': 3, 'q': 10, 'r': 1, 's': 1, 't': 1, 'u': 1, 'v': 4, 'w': 4, 'x': 8, 'y': 4, 'z': 10,
+}
+
+// RarityScorer ... 5 points for each letter in the answer multiplied by how rare the letter
+// is, less 2 * wrong letters - wrong words, so answers with uncommon letters are worth more.
+// Letters outside the English alphabet are valued 1. Never less than 0.
+type RarityScorer struct{}
+
+// Name ... returns "rarity".
+func (RarityScorer) Name() string { return "rarity" }
+
+// Score ... implements Scorer.
+func (RarityScorer) Score(game ScoredGame) int {
+	score := 0
+	for _, letter := range game.Answer {
+		if unicode.IsLetter(letter) {
+			score += 5 * max(1, letterValues[unicode.ToLower(letter)])
+		}
+	}
+	return max(0, score-2*game.MissedLetters-game.MissedWords)
+}
+
+// countLetters ... returns the number of letters in answer, ignoring separators.
+func countLetters(answer string) int {
+	count := 0
+	for _, r := range answer {
+		if unicode.IsLetter(r) {
+			count++
+		}
+	}
+	return count
+}
+
+// scorers ... every built in Scorer by name.
+var scorers = map[string]Scorer{
+	OriginalScorer{}.Name(): OriginalScorer{},
+	MissesScorer{}.Name():   MissesScorer{},
+	TimedScorer{}.Name():    TimedScorer{},
+	RarityScorer{}.Name():   RarityScorer{},
+}
+
+// ScorerNames ... returns the names of the built in scoring strategies, sorted.
+func ScorerNames() []string {
+	names := make([]string, 0, len(scorers))
+	for name := range scorers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ScorerByName ... returns the built in Scorer called name.
+func ScorerByName(name string) (Scorer, error) {
+	scorer, ok := scorers[name]
+	if !ok {
+		return nil, fmt.Errorf("hangmango: unknown scoring strategy %q, expected one of %v", name, ScorerNames())
+	}
+	return scorer, nil
+}
+
+// WithScorer ... sets the strategy won games are scored with.
+func WithScorer(scorer Scorer) Option {
+	return func(server *Server) error {
+		if scorer == nil {
+			return errors.New("hangmango: WithScorer requires a Scorer")
+		}
+		server.scorer = scorer
+		return nil
+	}
+}
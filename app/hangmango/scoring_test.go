@@ -0,0 +1,65 @@
+package hangmango
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScorers(t *testing.T) {
+	// apple guessed with a, p, x, l, e and grape, missing x and grape.
+	apple := ScoredGame{
+		Answer:        "apple",
+		Guesses:       []string{"a", "p", "x", "l", "e"},
+		WordGuesses:   []string{"grape"},
+		MissedLetters: 1,
+		MissedWords:   1,
+		Duration:      25 * time.Second,
+	}
+	// ox guessed after every other letter of the alphabet.
+	ox := ScoredGame{
+		Answer:        "ox",
+		Guesses:       []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j", "k", "l", "m", "n", "p", "q", "r", "s", "t", "u", "v", "w", "y", "z", "o", "x"},
+		MissedLetters: 24,
+	}
+	tests := []struct {
+		name   string
+		scorer Scorer
+		game   ScoredGame
+		want   int
+	}{
+		{name: "original", scorer: OriginalScorer{}, game: apple, want: 39},
+		{name: "original below zero", scorer: OriginalScorer{}, game: ox, want: -32},
+		{name: "misses", scorer: MissesScorer{}, game: apple, want: 47},
+		{name: "misses floored at zero", scorer: MissesScorer{}, game: ox, want: 0},
+		{name: "timed with the default interval", scorer: TimedScorer{}, game: apple, want: 45},
+		{name: "timed with an interval", scorer: TimedScorer{Interval: time.Second}, game: apple, want: 22},
+		{name: "timed floored at zero", scorer: TimedScorer{Interval: time.Millisecond}, game: apple, want: 0},
+		{name: "rarity", scorer: RarityScorer{}, game: apple, want: 42},
+		{name: "rarity of rare letters", scorer: RarityScorer{}, game: ScoredGame{Answer: "quiz"}, want: 110},
+		{name: "rarity floored at zero", scorer: RarityScorer{}, game: ox, want: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.scorer.Score(test.game); got != test.want {
+				t.Fatalf("%s Score() = %d, want %d", test.scorer.Name(), got, test.want)
+			}
+		})
+	}
+}
+
+func TestScorerByName(t *testing.T) {
+	for _, name := range ScorerNames() {
+		t.Run(name, func(t *testing.T) {
+			scorer, err := ScorerByName(name)
+			if err != nil {
+				t.Fatalf("ScorerByName(%q) error = %v", name, err)
+			}
+			if scorer.Name() != name {
+				t.Fatalf("ScorerByName(%q) returned %q", name, scorer.Name())
+			}
+		})
+	}
+	if _, err := ScorerByName("unknown"); err == nil {
+		t.Fatal(`ScorerByName("unknown") succeeded`)
+	}
+}
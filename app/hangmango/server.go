@@ -0,0 +1,396 @@
+// Package hangmango implements an embeddable hangmango game server. A Server
+// accepts connections on any net.Listener, negotiates an encrypted session
+// with each client per the protocol package and plays a game of hangman over it.
+//
+//	server, err := hangmango.NewServer(hangmango.WithKeys(encryptionKey, signingKey))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	go server.ListenAndServe()
+//	defer server.Shutdown(context.Background())
+package hangmango
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// DefaultAddr ... address ListenAndServe listens on unless WithAddr is used.
+const DefaultAddr = ":4444"
+
+// DefaultWords ... the answer pool used unless WithWords or WithWordlist is used.
+var DefaultWords = []string{"apple", "hello", "laminate", "sorcerer", "willow"}
+
+// ErrServerClosed ... returned by Serve and ListenAndServe after Shutdown has been called.
+var ErrServerClosed = errors.New("hangmango: server closed")
+
+// Server ... a hangmango server. Create one with NewServer, the zero value is not usable.
+type Server struct {
+	addr              string
+	answerPool        []string
+	encryptionKey     *rsa.PrivateKey
+	signingKey        *rsa.PrivateKey
+	certificate       []byte
+	keyOverlap        time.Duration
+	logger            *log.Logger
+	maxFrameSize      uint32
+	rekeyMessages     uint64
+	rekeyBytes        uint64
+	tlsConfig         *tls.Config
+	clientCAs         *x509.CertPool
+	requireClientAuth bool
+	// dropInvalidGuesses disconnects clients that send an invalid guess, see WithDropInvalidGuesses.
+	dropInvalidGuesses bool
+	lives              int
+	scorer             Scorer
+	alphabet           protocol.Alphabet
+	// legacyAnswerPool holds the answers written with A-Z alone, for the line protocol.
+	legacyAnswerPool []string
+
+	keysMu        sync.RWMutex
+	keys          *keySet
+	previousKeys  *keySet
+	previousUntil time.Time
+
+	manager      *clientManager
+	matchmaker   matchmaker
+	startOnce    sync.Once
+	shutdownOnce sync.Once
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	closing   bool
+}
+
+// Option ... configures a Server in NewServer.
+type Option func(*Server) error
+
+// WithAddr ... sets the address ListenAndServe listens on, for example ":4444".
+func WithAddr(addr string) Option {
+	return func(server *Server) error {
+		server.addr = addr
+		return nil
+	}
+}
+
+// WithWords ... replaces the answer pool games select their word from. Answers may be
+// phrases of several words separated by spaces, hyphens or apostrophes.
+func WithWords(words []string) Option {
+	return func(server *Server) error {
+		server.answerPool = nil
+		for _, word := range words {
+			answer, err := normalizeAnswer(word)
+			if err != nil {
+				return fmt.Errorf("hangmango: %s", err)
+			}
+			server.answerPool = append(server.answerPool, answer)
+		}
+		return nil
+	}
+}
+
+// WithWordlist ... appends a newline separated list of words or phrases read from r to the
+// answer pool games select their word from. Blank lines are skipped.
+func WithWordlist(r io.Reader) Option {
+	return func(server *Server) error {
+		scanner := bufio.NewScanner(r)
+		for line := 1; scanner.Scan(); line++ {
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			answer, err := normalizeAnswer(scanner.Text())
+			if err != nil {
+				return fmt.Errorf("hangmango: wordlist line %d - %s", line, err)
+			}
+			server.answerPool = append(server.answerPool, answer)
+		}
+		return scanner.Err()
+	}
+}
+
+// WithKeys ... sets the RSA key used to decrypt handshake messages from clients and
+// the key used to sign handshake messages to clients. Clients verify signatures
+// against the certificate issued for signingKey. If WithKeys isn't used, NewServer
+// generates ephemeral keys, which is only useful for tests.
+func WithKeys(encryptionKey *rsa.PrivateKey, signingKey *rsa.PrivateKey) Option {
+	return func(server *Server) error {
+		if encryptionKey == nil || signingKey == nil {
+			return errors.New("hangmango: WithKeys requires both an encryption and a signing key")
+		}
+		server.encryptionKey = encryptionKey
+		server.signingKey = signingKey
+		return nil
+	}
+}
+
+// WithLives ... sets how many wrong guesses a client can make before losing a game, zero
+// means games can't be lost.
+func WithLives(lives int) Option {
+	return func(server *Server) error {
+		if lives < 0 {
+			return errors.New("hangmango: lives can't be negative")
+		}
+		server.lives = lives
+		return nil
+	}
+}
+
+// WithLogger ... sets the logger server activity is written to, log.Default() is used otherwise.
+func WithLogger(logger *log.Logger) Option {
+	return func(server *Server) error {
+		server.logger = logger
+		return nil
+	}
+}
+
+// WithMaxFrameSize ... sets the largest frame that will be read from or written to a client.
+func WithMaxFrameSize(size uint32) Option {
+	return func(server *Server) error {
+		if size == 0 {
+			return errors.New("hangmango: maximum frame size must be greater than zero")
+		}
+		server.maxFrameSize = size
+		return nil
+	}
+}
+
+// WithRekeyLimits ... sets how many messages and plaintext bytes are sent to a client under
+// one AES-GCM key before it's replaced with a REKEY, zero uses the protocol defaults.
+func WithRekeyLimits(messages uint64, bytes uint64) Option {
+	return func(server *Server) error {
+		server.rekeyMessages = messages
+		server.rekeyBytes = bytes
+		return nil
+	}
+}
+
+// WithTLSConfig ... serves every listener over TLS using config. The bespoke handshake
+// is skipped for TLS connections and hangman messages are carried as plaintext JSON
+// inside the TLS channel.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(server *Server) error {
+		if config == nil || (len(config.Certificates) == 0 && config.GetCertificate == nil) {
+			return errors.New("hangmango: WithTLSConfig requires a certificate")
+		}
+		server.tlsConfig = config
+		return nil
+	}
+}
+
+// WithClientAuth ... verifies client certificates against the CAs in pool, recording the
+// certificate's common name as the identity of the client. Clients authenticate with a
+// CLIENTAUTH message after the handshake, or by presenting the certificate when connecting
+// over TLS. If required is set, clients that don't authenticate can't start a game.
+func WithClientAuth(pool *x509.CertPool, required bool) Option {
+	return func(server *Server) error {
+		if pool == nil {
+			return errors.New("hangmango: WithClientAuth requires a CA pool")
+		}
+		server.clientCAs = pool
+		server.requireClientAuth = required
+		return nil
+	}
+}
+
+// NewServer ... returns a Server configured with opts.
+func NewServer(opts ...Option) (*Server, error) {
+	server := &Server{
+		addr:         DefaultAddr,
+		answerPool:   append([]string(nil), DefaultWords...),
+		logger:       log.Default(),
+		maxFrameSize: protocol.DefaultMaxFrameSize,
+		keyOverlap:   DefaultKeyOverlap,
+		listeners:    make(map[net.Listener]struct{}),
+		// The protocol requires invalid guesses to drop the connection.
+		dropInvalidGuesses: true,
+		lives:              DefaultLives,
+		scorer:             DefaultScorer,
+		alphabet:           protocol.AlphabetEnglish,
+	}
+	for _, opt := range opts {
+		if err := opt(server); err != nil {
+			return nil, err
+		}
+	}
+	if len(server.answerPool) == 0 {
+		return nil, errors.New("hangmango: answer pool is empty")
+	}
+	for _, answer := range server.answerPool {
+		if err := server.alphabet.Check(answer); err != nil {
+			return nil, fmt.Errorf("hangmango: answer %q - %s", answer, err)
+		}
+		if protocol.AlphabetEnglish.Check(answer) == nil {
+			server.legacyAnswerPool = append(server.legacyAnswerPool, answer)
+		}
+	}
+
+	if server.encryptionKey == nil {
+		var err error
+		if server.encryptionKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, fmt.Errorf("hangmango: generating encryption key - %s", err)
+		}
+		if server.signingKey, err = rsa.GenerateKey(rand.Reader, 2048); err != nil {
+			return nil, fmt.Errorf("hangmango: generating signing key - %s", err)
+		}
+	}
+	keys, err := newKeySet(server.encryptionKey, server.signingKey, server.certificate)
+	if err != nil {
+		return nil, err
+	}
+	server.keys = keys
+
+	server.manager = &clientManager{
+		clients:    make(map[*client]bool),
+		register:   make(chan *client),
+		unregister: make(chan *client),
+		shutdown:   make(chan struct{}),
+		done:       make(chan struct{}),
+		logger:     server.logger,
+	}
+	server.matchmaker.waiting = make(map[protocol.GameSettings]*client)
+	return server, nil
+}
+
+// SigningPublicKey ... returns the public half of the key new handshakes are signed with.
+func (server *Server) SigningPublicKey() *rsa.PublicKey {
+	return &server.currentKeys().signingKey.PublicKey
+}
+
+// ListenAndServe ... listens on the configured TCP address and calls Serve.
+func (server *Server) ListenAndServe() error {
+	listener, err := net.Listen("tcp", server.addr)
+	if err != nil {
+		return err
+	}
+	return server.Serve(listener)
+}
+
+// Serve ... accepts connections on listener and plays hangman with each of them
+// until Shutdown is called. If a TLS config was provided the connections are
+// served over TLS. Serve always returns a non-nil error and closes listener.
+func (server *Server) Serve(listener net.Listener) error {
+	if server.tlsConfig != nil {
+		config := server.tlsConfig.Clone()
+		if server.clientCAs != nil {
+			config.ClientCAs = server.clientCAs
+			config.ClientAuth = tls.VerifyClientCertIfGiven
+			if server.requireClientAuth {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+			}
+		}
+		listener = tls.NewListener(listener, config)
+	}
+	server.logger.Printf("- Started server on %s\n", listener.Addr())
+	return server.serve(listener, server.handle)
+}
+
+// serve ... accepts connections on listener and passes each of them to handle until
+// Shutdown is called or accepting fails.
+func (server *Server) serve(listener net.Listener, handle func(net.Conn)) error {
+	if !server.trackListener(listener) {
+		listener.Close()
+		return ErrServerClosed
+	}
+	defer server.untrackListener(listener)
+	server.startOnce.Do(func() { go server.manager.start() })
+
+	for {
+		connection, err := listener.Accept()
+		if err != nil {
+			if server.shuttingDown() {
+				return ErrServerClosed
+			}
+			server.logger.Printf("- ERROR - Error accepting connection - %s\n", err)
+			return err
+		}
+		handle(connection)
+	}
+}
+
+// Shutdown ... stops accepting new connections, closes every connected client and
+// waits for their goroutines to finish or for ctx to be done, whichever happens first.
+func (server *Server) Shutdown(ctx context.Context) error {
+	server.mu.Lock()
+	server.closing = true
+	for listener := range server.listeners {
+		listener.Close()
+	}
+	server.mu.Unlock()
+
+	server.startOnce.Do(func() { go server.manager.start() })
+	server.shutdownOnce.Do(func() { close(server.manager.shutdown) })
+
+	select {
+	case <-server.manager.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// handle ... creates the client for a new connection, registers it with the
+// clientManager and starts its send and receive goroutines.
+func (server *Server) handle(connection net.Conn) {
+	_, secureTransport := connection.(*tls.Conn)
+	keys := server.currentKeys()
+	client := &client{
+		server: server,
+		socket: connection,
+		data:   make(chan []byte),
+		done:   make(chan struct{}),
+		stop:   make(chan struct{}),
+		codec:  protocol.NewCodec(connection, server.maxFrameSize),
+		session: protocol.NewSession(protocol.SessionConfig{
+			LocalKey:           keys.encryptionKey,
+			SigningKey:         keys.signingKey,
+			Server:             true,
+			SecureTransport:    secureTransport,
+			RekeyAfterMessages: server.rekeyMessages,
+			RekeyAfterBytes:    server.rekeyBytes,
+		}),
+		guid: fmt.Sprintf("%d", time.Now().Unix()),
+	}
+	if !server.manager.add(client) {
+		connection.Close()
+		return
+	}
+	go server.manager.receiveData(client)
+	go server.manager.sendData(client)
+}
+
+func (server *Server) trackListener(listener net.Listener) bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.closing {
+		return false
+	}
+	server.listeners[listener] = struct{}{}
+	return true
+}
+
+func (server *Server) untrackListener(listener net.Listener) {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	delete(server.listeners, listener)
+	listener.Close()
+}
+
+func (server *Server) shuttingDown() bool {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	return server.closing
+}
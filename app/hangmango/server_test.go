@@ -0,0 +1,218 @@
+package hangmango
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// testKey ... the key every test server encrypts and signs with, generating one per server
+// would make the tests slow.
+var (
+	testKeyOnce sync.Once
+	testKey     *rsa.PrivateKey
+	testKeyErr  error
+)
+
+// newTestServer ... returns a Server configured with opts that logs nowhere and is shut down
+// when the test ends.
+func newTestServer(t *testing.T, opts ...Option) *Server {
+	t.Helper()
+	testKeyOnce.Do(func() { testKey, testKeyErr = rsa.GenerateKey(rand.Reader, 2048) })
+	if testKeyErr != nil {
+		t.Fatalf("GenerateKey() error = %v", testKeyErr)
+	}
+	opts = append([]Option{WithKeys(testKey, testKey), WithLogger(log.New(io.Discard, "", 0))}, opts...)
+	server, err := NewServer(opts...)
+	if err != nil {
+		t.Fatalf("NewServer() error = %v", err)
+	}
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(ctx)
+	})
+	return server
+}
+
+// pipeListener ... a net.Listener whose connections are the server ends of net.Pipes
+// created by dial, so a test can talk to a Server without the network.
+type pipeListener struct {
+	conns     chan net.Conn
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener() *pipeListener {
+	return &pipeListener{conns: make(chan net.Conn), closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.closed:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr{}
+}
+
+// dial ... connects to the server accepting on the listener, failing the test if it has
+// stopped. Reads and writes on the connection fail if the test stalls.
+func (l *pipeListener) dial(t *testing.T) net.Conn {
+	t.Helper()
+	conn, server := net.Pipe()
+	select {
+	case l.conns <- server:
+	case <-l.closed:
+		t.Fatal("dial() on a closed listener")
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// pipeAddr ... the address of a pipeListener.
+type pipeAddr struct{}
+
+func (pipeAddr) Network() string { return "pipe" }
+func (pipeAddr) String() string  { return "pipe" }
+
+// testClient ... the client end of a hangmango protocol connection to a test server. Frames
+// are read as soon as they arrive, net.Pipe would otherwise block the server's writes until
+// the test is ready for them.
+type testClient struct {
+	t        *testing.T
+	conn     net.Conn
+	codec    *protocol.Codec
+	session  *protocol.Session
+	messages chan protocol.Message
+}
+
+// newTestClient ... connects to the server accepting on listener, offers features in HELLO
+// and establishes an ECDHE session, returning a client ready to send START GAME.
+func newTestClient(t *testing.T, listener *pipeListener, features ...protocol.Feature) *testClient {
+	t.Helper()
+	conn := listener.dial(t)
+	client := &testClient{
+		t:        t,
+		conn:     conn,
+		codec:    protocol.NewCodec(conn, 0),
+		session:  protocol.NewSession(protocol.SessionConfig{VerificationKey: &testKey.PublicKey}),
+		messages: make(chan protocol.Message, 32),
+	}
+	go client.read()
+
+	offer := protocol.Hello{Versions: protocol.SupportedVersions, Suites: []protocol.Suite{protocol.SuiteECDHE}, Features: features}
+	client.send(protocol.Message{Mtype: protocol.KindHello, Hello: &offer})
+	hello := client.expect(protocol.KindHello)
+	client.session.SetNegotiated(*hello.Hello)
+
+	ecdheKey, err := protocol.GenerateECDHEKey()
+	if err != nil {
+		t.Fatalf("GenerateECDHEKey() error = %v", err)
+	}
+	clientShare := ecdheKey.PublicKey().Bytes()
+	client.send(protocol.Message{Mtype: protocol.KindECDHEReq, Content: clientShare})
+	resp := client.expect(protocol.KindECDHEResp)
+	key, err := protocol.DeriveECDHESessionKey(ecdheKey, clientShare, resp.Content)
+	if err != nil {
+		t.Fatalf("DeriveECDHESessionKey() error = %v", err)
+	}
+	if err := client.session.SetSymmetricKey(key); err != nil {
+		t.Fatalf("SetSymmetricKey() error = %v", err)
+	}
+	return client
+}
+
+// read ... opens every frame from the server until the connection ends, binding the session
+// to each new game hash as the real client does.
+func (client *testClient) read() {
+	defer close(client.messages)
+	for {
+		frame, err := client.codec.ReadFrame()
+		if err != nil {
+			return
+		}
+		message, err := client.session.Open(frame)
+		if err != nil {
+			client.t.Errorf("Open() error = %v", err)
+			return
+		}
+		if len(message.Hash) > 0 {
+			client.session.SetGameHash(message.Hash)
+		}
+		client.messages <- message
+	}
+}
+
+// send ... seals and writes message, failing the test if it can't be.
+func (client *testClient) send(message protocol.Message) {
+	client.t.Helper()
+	frame, err := client.session.Seal(message)
+	if err != nil {
+		client.t.Fatalf("Seal() error = %v", err)
+	}
+	if err := client.codec.WriteFrame(frame); err != nil {
+		client.t.Fatalf("writing %s - %v", message.Mtype, err)
+	}
+}
+
+// leave ... disconnects from the server.
+func (client *testClient) leave() {
+	client.conn.Close()
+}
+
+// guess ... sends a guess in the current game.
+func (client *testClient) guess(guess string) {
+	client.t.Helper()
+	client.send(protocol.Message{Content: []byte(guess)})
+}
+
+// expect ... returns the next message from the server, failing the test unless it's kind.
+func (client *testClient) expect(kind protocol.Kind) protocol.Message {
+	client.t.Helper()
+	select {
+	case message, ok := <-client.messages:
+		if !ok {
+			client.t.Fatalf("connection closed, want %q", kind)
+		}
+		if message.Mtype != kind {
+			client.t.Fatalf("got %q %q, want %q", message.Mtype, message.Content, kind)
+		}
+		return message
+	case <-time.After(5 * time.Second):
+		client.t.Fatalf("timed out waiting for %q", kind)
+	}
+	return protocol.Message{}
+}
+
+// expectClosed ... fails the test unless the server ends the connection without sending
+// anything else.
+func (client *testClient) expectClosed() {
+	client.t.Helper()
+	select {
+	case message, ok := <-client.messages:
+		if ok {
+			client.t.Fatalf("got %q %q, want the connection closed", message.Mtype, message.Content)
+		}
+	case <-time.After(5 * time.Second):
+		client.t.Fatal("timed out waiting for the connection to close")
+	}
+}
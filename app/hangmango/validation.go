@@ -0,0 +1,75 @@
+package hangmango
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+// maxGuessLength ... longest guess, in letters, the protocol permits.
+const maxGuessLength = 100
+
+// GuessError ... describes why a guess was rejected by validateGuess.
+type GuessError struct {
+	Guess  string
+	Reason string
+}
+
+func (e *GuessError) Error() string {
+	return fmt.Sprintf("invalid guess %q - %s", e.Guess, e.Reason)
+}
+
+// validateGuess ... checks guess is a letter or word guess permitted by the protocol, using
+// the letters of alphabet, before it's passed on to HangmanState.process. Returns nil if the
+// guess is valid.
+func validateGuess(guess []byte, alphabet protocol.Alphabet) *GuessError {
+	switch {
+	case len(guess) == 0:
+		return &GuessError{Reason: "guesses can't be empty"}
+	case !utf8.Valid(guess):
+		return &GuessError{Guess: string(guess), Reason: "guesses must be UTF-8 text"}
+	case utf8.RuneCount(guess) > maxGuessLength:
+		return &GuessError{Guess: string([]rune(string(guess))[:maxGuessLength]) + "...", Reason: fmt.Sprintf("guesses are limited to %d letters", maxGuessLength)}
+	}
+	if err := alphabet.Check(string(guess)); err != nil {
+		return &GuessError{Guess: string(guess), Reason: err.Error()}
+	}
+	return nil
+}
+
+// WithAlphabet ... sets the alphabet answers are written in and guesses are validated with,
+// which is sent to clients with the first hint. Every answer in the pool must be written in
+// it. The default is protocol.AlphabetEnglish.
+func WithAlphabet(alphabet protocol.Alphabet) Option {
+	return func(server *Server) error {
+		if alphabet.Letters == "" {
+			return errors.New("hangmango: WithAlphabet requires an alphabet with letters")
+		}
+		server.alphabet = alphabet
+		return nil
+	}
+}
+
+// WithDropInvalidGuesses ... sets whether a client that sends an invalid guess is sent an
+// ERROR and disconnected, as the protocol requires, which is the default. Otherwise the
+// guess is answered with a REJECTED message and the game carries on.
+func WithDropInvalidGuesses(drop bool) Option {
+	return func(server *Server) error {
+		server.dropInvalidGuesses = drop
+		return nil
+	}
+}
+
+// rejectGuess ... logs the invalid guess and either disconnects the client or tells it the
+// guess was rejected, depending on WithDropInvalidGuesses.
+func (server *Server) rejectGuess(client *client, err *GuessError) {
+	if server.dropInvalidGuesses {
+		server.logger.Printf("- VALIDATION - FROM - %s - %s, connection closed", client.socket.RemoteAddr().String(), err)
+		client.fail(protocol.ErrorInvalidGuess, err.Reason)
+		return
+	}
+	server.logger.Printf("- VALIDATION - FROM - %s - %s, guess rejected", client.socket.RemoteAddr().String(), err)
+	client.send(protocol.Message{Mtype: protocol.KindRejected, Code: protocol.ErrorInvalidGuess, Content: []byte(err.Reason)})
+}
@@ -0,0 +1,52 @@
+package hangmango
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/tgmars/hangmango/app/protocol"
+)
+
+func TestValidateGuess(t *testing.T) {
+	tests := []struct {
+		name     string
+		guess    string
+		alphabet protocol.Alphabet
+		wantErr  bool
+	}{
+		{name: "letter", guess: "a"},
+		{name: "uppercase letter", guess: "A"},
+		{name: "word", guess: "Apple"},
+		{name: "longest guess", guess: strings.Repeat("a", maxGuessLength)},
+		{name: "too long", guess: strings.Repeat("a", maxGuessLength+1), wantErr: true},
+		{name: "empty", guess: "", wantErr: true},
+		{name: "digit", guess: "1", wantErr: true},
+		{name: "letters and digits", guess: "a1", wantErr: true},
+		{name: "phrase", guess: "jack-in-the-box"},
+		{name: "phrase with spaces and an apostrophe", guess: "Don't Panic"},
+		{name: "separators only", guess: " -'", wantErr: true},
+		{name: "trailing newline", guess: "a\n", wantErr: true},
+		{name: "punctuation", guess: "a!", wantErr: true},
+		{name: "letter outside the alphabet", guess: "é", wantErr: true},
+		{name: "letter of another alphabet", guess: "é", alphabet: protocol.AlphabetFrench},
+		{name: "uppercase letter of another alphabet", guess: "Ç", alphabet: protocol.AlphabetFrench},
+		{name: "combining mark composed", guess: "e\u0301", alphabet: protocol.AlphabetFrench},
+		{name: "uppercase combining mark composed", guess: "U\u0308ber", alphabet: protocol.AlphabetGerman},
+		{name: "composed letter outside the alphabet", guess: "a\u0301", alphabet: protocol.AlphabetGerman, wantErr: true},
+		{name: "combining mark alone", guess: "\u0308", alphabet: protocol.AlphabetGerman, wantErr: true},
+		{name: "longest guess of multibyte letters", guess: strings.Repeat("ä", maxGuessLength), alphabet: protocol.AlphabetGerman},
+		{name: "too many multibyte letters", guess: strings.Repeat("ä", maxGuessLength+1), alphabet: protocol.AlphabetGerman, wantErr: true},
+		{name: "invalid UTF-8", guess: "\xff", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.alphabet.Letters == "" {
+				test.alphabet = protocol.AlphabetEnglish
+			}
+			err := validateGuess([]byte(test.guess), test.alphabet)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("validateGuess(%q) = %v, want error %v", test.guess, err, test.wantErr)
+			}
+		})
+	}
+}
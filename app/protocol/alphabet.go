@@ -0,0 +1,139 @@
+package protocol
+
+// alphabet contains the letters a game may be played with. The server chooses an alphabet
+// for its wordlist and sends it with the first hint, so the client validates guesses with
+// the same letters the server does. Letters are single runes in their precomposed form, so
+// combining marks are composed with the letter before them, and case is folded with the
+// Unicode lowercase mapping before they're compared.
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Alphabet ... the letters answers and guesses may contain, in lowercase. Spaces, hyphens
+// and apostrophes separate the words of a phrase and are permitted with any alphabet.
+type Alphabet struct {
+	Name    string
+	Letters string
+}
+
+// The built in alphabets, each of which includes every letter from A-Z.
+var (
+	// AlphabetEnglish ... the letters A-Z, the alphabet used unless the server chooses another.
+	AlphabetEnglish = Alphabet{Name: "english", Letters: "abcdefghijklmnopqrstuvwxyz"}
+	// AlphabetGerman ... A-Z with the umlauts and eszett.
+	AlphabetGerman = Alphabet{Name: "german", Letters: "abcdefghijklmnopqrstuvwxyzäöüß"}
+	// AlphabetSpanish ... A-Z with ñ, the acute accents and the diaeresis.
+	AlphabetSpanish = Alphabet{Name: "spanish", Letters: "abcdefghijklmnopqrstuvwxyzáéíñóúü"}
+	// AlphabetFrench ... A-Z with the accents, cedilla and ligatures used in French.
+	AlphabetFrench = Alphabet{Name: "french", Letters: "abcdefghijklmnopqrstuvwxyzàâæçéèêëîïôœùûüÿ"}
+)
+
+// alphabets ... every built in Alphabet by name.
+var alphabets = map[string]Alphabet{
+	AlphabetEnglish.Name: AlphabetEnglish,
+	AlphabetGerman.Name:  AlphabetGerman,
+	AlphabetSpanish.Name: AlphabetSpanish,
+	AlphabetFrench.Name:  AlphabetFrench,
+}
+
+// AlphabetNames ... returns the names of the built in alphabets, sorted.
+func AlphabetNames() []string {
+	names := make([]string, 0, len(alphabets))
+	for name := range alphabets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// AlphabetByName ... returns the built in Alphabet called name.
+func AlphabetByName(name string) (Alphabet, error) {
+	alphabet, ok := alphabets[name]
+	if !ok {
+		return Alphabet{}, fmt.Errorf("unknown alphabet %q, expected one of %v", name, AlphabetNames())
+	}
+	return alphabet, nil
+}
+
+// compositions ... the precomposed rune for each lowercase letter of the built in alphabets
+// that Unicode decomposes, by its base letter and combining mark. init adds the uppercase
+// letters.
+var compositions = map[[2]rune]rune{
+	{'a', '\u0300'}: 'à', {'e', '\u0300'}: 'è', {'u', '\u0300'}: 'ù',
+	{'a', '\u0301'}: 'á', {'e', '\u0301'}: 'é', {'i', '\u0301'}: 'í', {'o', '\u0301'}: 'ó', {'u', '\u0301'}: 'ú',
+	{'a', '\u0302'}: 'â', {'e', '\u0302'}: 'ê', {'i', '\u0302'}: 'î', {'o', '\u0302'}: 'ô', {'u', '\u0302'}: 'û',
+	{'n', '\u0303'}: 'ñ',
+	{'a', '\u0308'}: 'ä', {'e', '\u0308'}: 'ë', {'i', '\u0308'}: 'ï', {'o', '\u0308'}: 'ö', {'u', '\u0308'}: 'ü', {'y', '\u0308'}: 'ÿ',
+	{'c', '\u0327'}: 'ç',
+}
+
+func init() {
+	upper := make(map[[2]rune]rune, len(compositions))
+	for pair, composed := range compositions {
+		upper[[2]rune{unicode.ToUpper(pair[0]), pair[1]}] = unicode.ToUpper(composed)
+	}
+	for pair, composed := range upper {
+		compositions[pair] = composed
+	}
+}
+
+// Normalize ... composes each letter of the built in alphabets typed as a base letter
+// followed by a combining mark into the single precomposed rune the alphabet contains, as
+// Unicode normalisation form C would. This is only the part of NFC the built in alphabets
+// need, anything else is returned unchanged, as is text that isn't UTF-8. Answers and
+// guesses are normalised before they're validated or compared.
+func Normalize(text string) string {
+	if !utf8.ValidString(text) {
+		return text
+	}
+	normalized := make([]rune, 0, len(text))
+	for _, r := range text {
+		if n := len(normalized); n > 0 {
+			if composed, ok := compositions[[2]rune{normalized[n-1], r}]; ok {
+				normalized[n-1] = composed
+				continue
+			}
+		}
+		normalized = append(normalized, r)
+	}
+	return string(normalized)
+}
+
+// IsSeparator ... reports whether r separates the words of a phrase.
+func IsSeparator(r rune) bool {
+	return r == ' ' || r == '-' || r == '\''
+}
+
+// Contains ... reports whether r, in either case, is a letter of the alphabet.
+func (a Alphabet) Contains(r rune) bool {
+	return unicode.IsLetter(r) && strings.ContainsRune(a.Letters, unicode.ToLower(r))
+}
+
+// Check ... returns an error unless text, once normalised, only contains letters of the
+// alphabet and separators, with at least one letter.
+func (a Alphabet) Check(text string) error {
+	letters := 0
+	for _, r := range Normalize(text) {
+		switch {
+		case a.Contains(r):
+			letters++
+		case !IsSeparator(r):
+			return fmt.Errorf("%q isn't a letter of the %s alphabet, a space, hyphen or apostrophe", r, a.Name)
+		}
+	}
+	if letters == 0 {
+		return errors.New("there must be at least one letter")
+	}
+	return nil
+}
+
+// String ... formats the Alphabet for logs.
+func (a Alphabet) String() string {
+	return a.Name
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{name: "ASCII", text: "apple", want: "apple"},
+		{name: "precomposed", text: "\u00fcber", want: "\u00fcber"},
+		{name: "combining diaeresis", text: "u\u0308ber", want: "\u00fcber"},
+		{name: "uppercase", text: "U\u0308BER", want: "\u00dcBER"},
+		{name: "every mark", text: "a\u0300e\u0301i\u0302n\u0303y\u0308c\u0327", want: "\u00e0\u00e9\u00ee\u00f1\u00ff\u00e7"},
+		{name: "Y with diaeresis", text: "Y\u0308", want: "\u0178"},
+		{name: "mark on a letter with no composition", text: "x\u0308", want: "x\u0308"},
+		{name: "mark on a separator", text: "-\u0301", want: "-\u0301"},
+		{name: "mark at the start", text: "\u0308a", want: "\u0308a"},
+		{name: "two marks", text: "a\u0308\u0301", want: "\u00e4\u0301"},
+		{name: "invalid UTF-8", text: "a\xffu\u0308", want: "a\xffu\u0308"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Normalize(test.text); got != test.want {
+				t.Fatalf("Normalize(%q) = %q, want %q", test.text, got, test.want)
+			}
+		})
+	}
+}
+
+func TestAlphabetCheck(t *testing.T) {
+	tests := []struct {
+		name     string
+		alphabet Alphabet
+		text     string
+		wantErr  bool
+	}{
+		{name: "word", alphabet: AlphabetEnglish, text: "apple"},
+		{name: "uppercase", alphabet: AlphabetEnglish, text: "APPLE"},
+		{name: "phrase", alphabet: AlphabetEnglish, text: "don't panic"},
+		{name: "letter outside the alphabet", alphabet: AlphabetEnglish, text: "café", wantErr: true},
+		{name: "letter of the alphabet", alphabet: AlphabetFrench, text: "café"},
+		{name: "combining mark", alphabet: AlphabetFrench, text: "cafe\u0301"},
+		{name: "eszett", alphabet: AlphabetGerman, text: "straße"},
+		{name: "capital eszett", alphabet: AlphabetGerman, text: "STRA\u1e9eE"},
+		{name: "ligature", alphabet: AlphabetFrench, text: "Œuvre"},
+		{name: "ligature outside the alphabet", alphabet: AlphabetSpanish, text: "œuvre", wantErr: true},
+		{name: "digit", alphabet: AlphabetEnglish, text: "a1", wantErr: true},
+		{name: "separators only", alphabet: AlphabetEnglish, text: "- '", wantErr: true},
+		{name: "empty", alphabet: AlphabetEnglish, text: "", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.alphabet.Check(test.text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("%s Check(%q) = %v, want error %v", test.alphabet, test.text, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestAlphabetByName(t *testing.T) {
+	for _, name := range AlphabetNames() {
+		t.Run(name, func(t *testing.T) {
+			alphabet, err := AlphabetByName(name)
+			if err != nil {
+				t.Fatalf("AlphabetByName(%q) error = %v", name, err)
+			}
+			if alphabet.Name != name {
+				t.Fatalf("AlphabetByName(%q) returned %q", name, alphabet.Name)
+			}
+			// Every built in alphabet includes A-Z.
+			if err := alphabet.Check(AlphabetEnglish.Letters); err != nil {
+				t.Fatalf("%s Check(A-Z) = %v", name, err)
+			}
+		})
+	}
+	if _, err := AlphabetByName("klingon"); err == nil {
+		t.Fatal(`AlphabetByName("klingon") succeeded`)
+	}
+}
@@ -0,0 +1,83 @@
+package protocol
+
+// cipher contains the AES-GCM state for one direction of a session. Each direction has its
+// own key, derived from the session key, and nonces are built from the sequence number of
+// the message instead of being random, so a nonce can never repeat under a key. Keys are
+// replaced with a REKEY message before they've protected enough data to weaken GCM.
+
+import (
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+// DefaultRekeyAfterMessages ... messages sent under a key before it's replaced, unless
+// SessionConfig says otherwise.
+const DefaultRekeyAfterMessages = 1 << 30
+
+// DefaultRekeyAfterBytes ... plaintext bytes sent under a key before it's replaced, unless
+// SessionConfig says otherwise.
+const DefaultRekeyAfterBytes = 1 << 36
+
+// HKDF info labels for the key of each direction, derived from the session key.
+const (
+	clientToServerKeyLabel = "hangmango client to server key"
+	serverToClientKeyLabel = "hangmango server to client key"
+)
+
+// cipherState ... AES-GCM key for one direction of a session and how much it has been used.
+type cipherState struct {
+	aead     cipher.AEAD
+	messages uint64
+	bytes    uint64
+}
+
+// newCipherState ... returns the cipherState for key.
+func newCipherState(key []byte) (*cipherState, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return &cipherState{aead: aead}, nil
+}
+
+// deriveDirectionKey ... derives the key for messages sent by the server if fromServer is
+// set, or by the client otherwise, from the session key.
+func deriveDirectionKey(sessionKey []byte, fromServer bool) ([]byte, error) {
+	label := clientToServerKeyLabel
+	if fromServer {
+		label = serverToClientKeyLabel
+	}
+	return hkdf.Key(sha256.New, sessionKey, nil, label, SymmetricKeySize)
+}
+
+// nonce ... returns the GCM nonce for the message with sequence number seq.
+func (c *cipherState) nonce(seq uint64) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// seal ... encrypts plaintext as the message with sequence number seq.
+func (c *cipherState) seal(seq uint64, plaintext []byte, additionalData []byte) []byte {
+	c.messages++
+	c.bytes += uint64(len(plaintext))
+	return c.aead.Seal(nil, c.nonce(seq), plaintext, additionalData)
+}
+
+// open ... decrypts and authenticates ciphertext as the message with sequence number seq.
+func (c *cipherState) open(seq uint64, ciphertext []byte, additionalData []byte) ([]byte, error) {
+	plaintext, err := c.aead.Open(nil, c.nonce(seq), ciphertext, additionalData)
+	if err != nil {
+		return nil, err
+	}
+	c.messages++
+	c.bytes += uint64(len(plaintext))
+	return plaintext, nil
+}
+
+// exceeds ... reports whether the key has been used for at least messages messages or bytes bytes.
+func (c *cipherState) exceeds(messages uint64, bytes uint64) bool {
+	return c.messages >= messages || c.bytes >= bytes
+}
@@ -0,0 +1,87 @@
+package protocol
+
+// codec contains the length-prefixed framing layer used to delimit EncryptedMessage
+// structs on the wire. Each frame is a 4 byte big endian length followed by that many
+// bytes of JSON, so frames that are split across or coalesced within TCP segments are
+// reassembled before being handed to the caller.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// FrameHeaderSize ... number of bytes used to encode the length of a frame.
+const FrameHeaderSize = 4
+
+// DefaultMaxFrameSize ... largest frame accepted by a Codec unless configured otherwise.
+const DefaultMaxFrameSize = 65536
+
+// ProtocolError ... returned when a peer sends data that violates the protocol,
+// the connection should be dropped when one is encountered.
+type ProtocolError struct {
+	Reason string
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("protocol error - %s", e.Reason)
+}
+
+// Codec ... reads and writes frames on a connection. Reads are buffered so partial
+// frames are reassembled. A Codec is safe for one concurrent reader and one concurrent
+// writer.
+type Codec struct {
+	reader       *bufio.Reader
+	writer       io.Writer
+	maxFrameSize uint32
+}
+
+// NewCodec ... returns a Codec for rw that rejects frames larger than maxFrameSize.
+// A maxFrameSize of 0 selects DefaultMaxFrameSize.
+func NewCodec(rw io.ReadWriter, maxFrameSize uint32) *Codec {
+	if maxFrameSize == 0 {
+		maxFrameSize = DefaultMaxFrameSize
+	}
+	return &Codec{reader: bufio.NewReader(rw), writer: rw, maxFrameSize: maxFrameSize}
+}
+
+// ReadFrame ... blocks until a full frame has been read and returns its payload.
+// The length is validated before any buffer is allocated for the payload, so a peer
+// can't force us to hold more than maxFrameSize bytes for a single message.
+func (c *Codec) ReadFrame() ([]byte, error) {
+	header := make([]byte, FrameHeaderSize)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		return nil, err
+	}
+	length := binary.BigEndian.Uint32(header)
+	if length == 0 {
+		return nil, &ProtocolError{Reason: "received an empty frame"}
+	}
+	if length > c.maxFrameSize {
+		return nil, &ProtocolError{Reason: fmt.Sprintf("frame of %d bytes exceeds the maximum of %d bytes", length, c.maxFrameSize)}
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.reader, payload); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return payload, nil
+}
+
+// WriteFrame ... prefixes payload with its length and writes it in a single call.
+func (c *Codec) WriteFrame(payload []byte) error {
+	if len(payload) == 0 {
+		return &ProtocolError{Reason: "refusing to send an empty frame"}
+	}
+	if uint64(len(payload)) > uint64(c.maxFrameSize) {
+		return &ProtocolError{Reason: fmt.Sprintf("frame of %d bytes exceeds the maximum of %d bytes", len(payload), c.maxFrameSize)}
+	}
+	frame := make([]byte, FrameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	copy(frame[FrameHeaderSize:], payload)
+	_, err := c.writer.Write(frame)
+	return err
+}
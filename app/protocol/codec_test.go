@@ -0,0 +1,159 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// readWriter ... joins a reader and a writer into the io.ReadWriter a Codec needs.
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// frame ... returns payload prefixed with length as it would appear on the wire.
+func frame(length uint32, payload []byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, length), payload...)
+}
+
+func TestReadFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		wire    []byte
+		split   bool
+		want    [][]byte
+		wantErr error
+		proto   bool
+	}{
+		{
+			name: "single frame",
+			wire: frame(5, []byte("hello")),
+			want: [][]byte{[]byte("hello")},
+		},
+		{
+			name:  "split across reads",
+			wire:  frame(5, []byte("hello")),
+			split: true,
+			want:  [][]byte{[]byte("hello")},
+		},
+		{
+			name: "merged in one read",
+			wire: append(frame(5, []byte("hello")), frame(3, []byte("bye"))...),
+			want: [][]byte{[]byte("hello"), []byte("bye")},
+		},
+		{
+			name:  "merged and split",
+			wire:  append(frame(5, []byte("hello")), frame(3, []byte("bye"))...),
+			split: true,
+			want:  [][]byte{[]byte("hello"), []byte("bye")},
+		},
+		{
+			name: "largest frame permitted",
+			wire: frame(16, bytes.Repeat([]byte("a"), 16)),
+			want: [][]byte{bytes.Repeat([]byte("a"), 16)},
+		},
+		{
+			name:  "oversized frame",
+			wire:  frame(17, bytes.Repeat([]byte("a"), 17)),
+			proto: true,
+		},
+		{
+			name:  "oversized length without a payload",
+			wire:  frame(0xffffffff, nil),
+			proto: true,
+		},
+		{
+			name:  "empty frame",
+			wire:  frame(0, nil),
+			proto: true,
+		},
+		{
+			name:    "truncated payload",
+			wire:    frame(5, []byte("hel")),
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "truncated header",
+			wire:    []byte{0, 0},
+			wantErr: io.ErrUnexpectedEOF,
+		},
+		{
+			name:    "closed between frames",
+			wire:    nil,
+			wantErr: io.EOF,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var reader io.Reader = bytes.NewReader(test.wire)
+			if test.split {
+				reader = iotest.OneByteReader(reader)
+			}
+			codec := NewCodec(readWriter{reader, io.Discard}, 16)
+			for _, want := range test.want {
+				got, err := codec.ReadFrame()
+				if err != nil {
+					t.Fatalf("ReadFrame() error = %v", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Fatalf("ReadFrame() = %q, want %q", got, want)
+				}
+			}
+			if test.want != nil {
+				test.wantErr = io.EOF
+			}
+			_, err := codec.ReadFrame()
+			var protocolErr *ProtocolError
+			switch {
+			case test.proto && !errors.As(err, &protocolErr):
+				t.Fatalf("ReadFrame() error = %v, want a ProtocolError", err)
+			case !test.proto && err != test.wantErr:
+				t.Fatalf("ReadFrame() error = %v, want %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteFrame(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		proto   bool
+	}{
+		{name: "payload", payload: []byte("hello")},
+		{name: "largest frame permitted", payload: bytes.Repeat([]byte("a"), 16)},
+		{name: "oversized frame", payload: bytes.Repeat([]byte("a"), 17), proto: true},
+		{name: "empty frame", payload: nil, proto: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var wire bytes.Buffer
+			codec := NewCodec(readWriter{&wire, &wire}, 16)
+			err := codec.WriteFrame(test.payload)
+			if test.proto {
+				var protocolErr *ProtocolError
+				if !errors.As(err, &protocolErr) {
+					t.Fatalf("WriteFrame() error = %v, want a ProtocolError", err)
+				}
+				if wire.Len() != 0 {
+					t.Fatalf("WriteFrame() wrote %d bytes of a rejected frame", wire.Len())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("WriteFrame() error = %v", err)
+			}
+			if want := frame(uint32(len(test.payload)), test.payload); !bytes.Equal(wire.Bytes(), want) {
+				t.Fatalf("WriteFrame() wrote %x, want %x", wire.Bytes(), want)
+			}
+			got, err := codec.ReadFrame()
+			if err != nil || !bytes.Equal(got, test.payload) {
+				t.Fatalf("ReadFrame() = %q, %v, want %q", got, err, test.payload)
+			}
+		})
+	}
+}
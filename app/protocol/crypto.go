@@ -0,0 +1,67 @@
+package protocol
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+)
+
+// SymmetricKeySize ... length in bytes of the AES-256 key used for a session.
+const SymmetricKeySize = 32
+
+// EncryptRSA ... encrypts message for the holder of pubkey with RSA-OAEP and SHA256.
+func EncryptRSA(message []byte, pubkey *rsa.PublicKey) ([]byte, error) {
+	return rsa.EncryptOAEP(sha256.New(), rand.Reader, pubkey, message, nil)
+}
+
+// DecryptRSA ... decrypts an RSA-OAEP and SHA256 ciphertext produced by EncryptRSA.
+func DecryptRSA(ciphertext []byte, privkey *rsa.PrivateKey) ([]byte, error) {
+	return rsa.DecryptOAEP(sha256.New(), rand.Reader, privkey, ciphertext, nil)
+}
+
+// GenerateSymmetricKey ... returns securely generated random bytes suitable for
+// use as an AES-256 key.
+func GenerateSymmetricKey() ([]byte, error) {
+	b := make([]byte, SymmetricKeySize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Sign ... signs data with RSA-PSS over a SHA256 digest.
+func Sign(data []byte, privkey *rsa.PrivateKey) ([]byte, error) {
+	hashed := sha256.Sum256(data)
+	return rsa.SignPSS(rand.Reader, privkey, crypto.SHA256, hashed[:], nil)
+}
+
+// Verify ... verifies an RSA-PSS signature produced by Sign.
+func Verify(data []byte, signature []byte, pubkey *rsa.PublicKey) error {
+	hashed := sha256.Sum256(data)
+	return rsa.VerifyPSS(pubkey, crypto.SHA256, hashed[:], signature, nil)
+}
+
+// KeyID ... returns a short identifier for a server signing key, the first 8 bytes of the
+// SHA256 digest of its PKIX encoding in hex. Clients send the ID of the certificate they hold
+// so the server can keep using that key while it's being rotated out.
+func KeyID(pubkey *rsa.PublicKey) string {
+	der, err := x509.MarshalPKIXPublicKey(pubkey)
+	if err != nil {
+		return ""
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:8])
+}
@@ -0,0 +1,9 @@
+// Package protocol implements the hangmango wire protocol shared by the
+// hangmango client and server. It provides the message types exchanged by
+// both parties, a length-prefixed frame codec, the RSA and AES-GCM primitives
+// used to protect messages and a Session type that tracks the state of the
+// encrypted channel for a single connection.
+//
+// Tools and bots that want to talk to a hangmango server can use this package
+// directly instead of reimplementing the handshake.
+package protocol
@@ -0,0 +1,65 @@
+package protocol
+
+// ecdhe contains the ephemeral X25519 key agreement used by handshake version 2.
+// Both sides contribute an ephemeral key share, the server signs both shares with its
+// certificate key and the session key is derived from the shared secret with HKDF,
+// so recorded sessions can't be decrypted after the servers long term keys are compromised.
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+)
+
+// ecdheLabel ... domain separates the signed transcript and the HKDF output of the handshake.
+const ecdheLabel = "hangmango ECDHE X25519 v2"
+
+// GenerateECDHEKey ... returns a new ephemeral X25519 private key.
+func GenerateECDHEKey() (*ecdh.PrivateKey, error) {
+	return ecdh.X25519().GenerateKey(rand.Reader)
+}
+
+// ecdheTranscript ... returns the bytes signed by the server, binding its share to the clients.
+func ecdheTranscript(clientShare []byte, serverShare []byte) []byte {
+	var transcript bytes.Buffer
+	transcript.WriteString(ecdheLabel)
+	transcript.Write(clientShare)
+	transcript.Write(serverShare)
+	return transcript.Bytes()
+}
+
+// SignECDHEShares ... signs both key shares of a handshake with the servers signing key.
+func SignECDHEShares(clientShare []byte, serverShare []byte, signingKey *rsa.PrivateKey) ([]byte, error) {
+	return Sign(ecdheTranscript(clientShare, serverShare), signingKey)
+}
+
+// VerifyECDHEShares ... verifies a signature produced by SignECDHEShares.
+func VerifyECDHEShares(clientShare []byte, serverShare []byte, signature []byte, verificationKey *rsa.PublicKey) error {
+	if len(signature) == 0 {
+		return errors.New("ECDHE key share is not signed")
+	}
+	return Verify(ecdheTranscript(clientShare, serverShare), signature, verificationKey)
+}
+
+// DeriveECDHESessionKey ... completes the key agreement with the peers share and derives
+// the AES-256 session key with HKDF-SHA256, salted with both shares in client, server order.
+func DeriveECDHESessionKey(local *ecdh.PrivateKey, clientShare []byte, serverShare []byte) ([]byte, error) {
+	peerShare := serverShare
+	if bytes.Equal(local.PublicKey().Bytes(), serverShare) {
+		peerShare = clientShare
+	}
+	peer, err := ecdh.X25519().NewPublicKey(peerShare)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := local.ECDH(peer)
+	if err != nil {
+		return nil, err
+	}
+	salt := append(append([]byte(nil), clientShare...), serverShare...)
+	return hkdf.Key(sha256.New, secret, salt, ecdheLabel, SymmetricKeySize)
+}
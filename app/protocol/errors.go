@@ -0,0 +1,117 @@
+package protocol
+
+// errors contains the error types returned by Session and the ERROR message a party sends
+// before closing a connection, so the peer can tell the user why it was dropped.
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CryptoError ... returned when a message can't be encrypted, decrypted or its signature
+// verified, Op describes what was being attempted.
+type CryptoError struct {
+	Op  string
+	Err error
+}
+
+func (e *CryptoError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Op, e.Err)
+}
+
+// Unwrap ... returns the underlying error.
+func (e *CryptoError) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode ... identifies why a party sent an ERROR message.
+type ErrorCode int
+
+const (
+	// ErrorMalformed ... a message couldn't be parsed.
+	ErrorMalformed ErrorCode = iota + 1
+	// ErrorProtocol ... a message violated the protocol, including replayed, reordered
+	// or unauthenticated AES-GCM messages.
+	ErrorProtocol
+	// ErrorCrypto ... a message couldn't be decrypted or its signature verified.
+	ErrorCrypto
+	// ErrorUnauthenticated ... the client failed or didn't complete client authentication.
+	ErrorUnauthenticated
+	// ErrorGameHash ... the game hash sent by the client didn't match the game.
+	ErrorGameHash
+	// ErrorInternal ... the sender failed for reasons unrelated to the peer.
+	ErrorInternal
+	// ErrorNegotiation ... the client and server have no protocol version or cipher suite in
+	// common, or a message was sent before HELLO.
+	ErrorNegotiation
+	// ErrorInvalidGuess ... a guess was empty, too long or contained characters outside
+	// the alphabet permitted by the protocol.
+	ErrorInvalidGuess
+	// ErrorSettings ... the settings sent with START GAME were invalid, or no answer fits them.
+	ErrorSettings
+)
+
+// String ... returns a readable name for the code.
+func (c ErrorCode) String() string {
+	switch c {
+	case ErrorMalformed:
+		return "malformed message"
+	case ErrorProtocol:
+		return "protocol violation"
+	case ErrorCrypto:
+		return "cryptographic failure"
+	case ErrorUnauthenticated:
+		return "authentication failed"
+	case ErrorGameHash:
+		return "game hash mismatch"
+	case ErrorInternal:
+		return "internal error"
+	case ErrorNegotiation:
+		return "negotiation failed"
+	case ErrorInvalidGuess:
+		return "invalid guess"
+	case ErrorSettings:
+		return "invalid game settings"
+	}
+	return fmt.Sprintf("error %d", int(c))
+}
+
+// ErrorCodeFor ... returns the code that describes err, as returned by Session or Codec.
+func ErrorCodeFor(err error) ErrorCode {
+	var protocolError *ProtocolError
+	var cryptoError *CryptoError
+	var negotiationError *NegotiationError
+	switch {
+	case errors.As(err, &protocolError):
+		return ErrorProtocol
+	case errors.As(err, &cryptoError):
+		return ErrorCrypto
+	case errors.As(err, &negotiationError):
+		return ErrorNegotiation
+	}
+	return ErrorMalformed
+}
+
+// NewErrorMessage ... returns the ERROR message sent before closing a connection.
+func NewErrorMessage(code ErrorCode, reason string) Message {
+	return Message{Mtype: KindError, Code: code, Content: []byte(reason)}
+}
+
+// RemoteError ... the contents of an ERROR message received from the peer.
+type RemoteError struct {
+	Code   ErrorCode
+	Reason string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("%s - %s", e.Code, e.Reason)
+}
+
+// Err ... returns the RemoteError carried by an ERROR or REJECTED message, or nil for any
+// other message.
+func (m Message) Err() error {
+	if m.Mtype != KindError && m.Mtype != KindRejected {
+		return nil
+	}
+	return &RemoteError{Code: m.Code, Reason: string(m.Content)}
+}
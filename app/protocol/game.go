@@ -0,0 +1,198 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Outcome ... how a game ended, carried in the Result of a GAME OVER.
+type Outcome string
+
+const (
+	// OutcomeWon ... the client guessed the answer.
+	OutcomeWon Outcome = "won"
+	// OutcomeLost ... the client ran out of lives before guessing the answer.
+	OutcomeLost Outcome = "lost"
+	// OutcomeBeaten ... the client's opponent in a race guessed the answer first.
+	OutcomeBeaten Outcome = "beaten"
+	// OutcomeForfeit ... the player left a race before it was over.
+	OutcomeForfeit Outcome = "forfeit"
+)
+
+// Difficulty ... names a preset for the settings of a game, which the server resolves.
+type Difficulty string
+
+const (
+	// DifficultyEasy ... short answers and plenty of lives.
+	DifficultyEasy Difficulty = "easy"
+	// DifficultyMedium ... medium length answers.
+	DifficultyMedium Difficulty = "medium"
+	// DifficultyHard ... long answers and few lives.
+	DifficultyHard Difficulty = "hard"
+)
+
+// GameSettings ... sent by the client with START GAME to choose the game it's given, and
+// echoed by the server with the first hint once it has resolved them. Difficulty picks one
+// of the server's presets and MinLength, MaxLength and Lives override it. MinLength and
+// MaxLength bound the number of letters in the answer. Fields left at zero are up to the
+// server, and in the echo a MaxLength of 0 means there's no upper bound and Lives of 0
+// means the game can't be lost. Race asks to be paired with another player asking for the
+// same settings, see OpponentStatus.
+type GameSettings struct {
+	Difficulty Difficulty `json:",omitempty"`
+	MinLength  int        `json:",omitempty"`
+	MaxLength  int        `json:",omitempty"`
+	Lives      int        `json:",omitempty"`
+	Race       bool       `json:",omitempty"`
+}
+
+// Check ... returns an error if the settings can't be satisfied by any server.
+func (s GameSettings) Check() error {
+	switch s.Difficulty {
+	case "", DifficultyEasy, DifficultyMedium, DifficultyHard:
+	default:
+		return fmt.Errorf("unknown difficulty %q, expected one of easy, medium or hard", s.Difficulty)
+	}
+	switch {
+	case s.MinLength < 0, s.MaxLength < 0:
+		return errors.New("word lengths can't be negative")
+	case s.Lives < 0:
+		return errors.New("lives can't be negative")
+	case s.MaxLength > 0 && s.MinLength > s.MaxLength:
+		return fmt.Errorf("minimum word length %d is longer than the maximum %d", s.MinLength, s.MaxLength)
+	}
+	return nil
+}
+
+// ParseGameSettings ... parses settings written as a comma separated list of a difficulty
+// and min=, max= or lives= values, for example "hard" or "easy,lives=3" or "min=4,max=6".
+func ParseGameSettings(text string) (GameSettings, error) {
+	var settings GameSettings
+	for _, field := range strings.Split(text, ",") {
+		field = strings.TrimSpace(field)
+		key, value, found := strings.Cut(field, "=")
+		if !found {
+			if field != "" {
+				settings.Difficulty = Difficulty(field)
+			}
+			continue
+		}
+		number, err := strconv.Atoi(value)
+		if err != nil || number < 1 {
+			return GameSettings{}, fmt.Errorf("%s must be a number greater than 0", key)
+		}
+		switch key {
+		case "min":
+			settings.MinLength = number
+		case "max":
+			settings.MaxLength = number
+		case "lives":
+			settings.Lives = number
+		default:
+			return GameSettings{}, fmt.Errorf("unknown setting %q, expected min, max or lives", key)
+		}
+	}
+	return settings, settings.Check()
+}
+
+// GameStatus ... sent with every hint so the client can show the state of the game.
+// Lives is the number of wrong guesses the client can still make out of MaxLives, both
+// are zero when the game has no lives limit. Guessed holds every letter guessed so far
+// in alphabetical order. Alphabet is only sent with the first hint, it holds the letters
+// guesses may contain and is English if the server didn't send one.
+type GameStatus struct {
+	Lives    int       `json:",omitempty"`
+	MaxLives int       `json:",omitempty"`
+	Guessed  string    `json:",omitempty"`
+	Alphabet *Alphabet `json:",omitempty"`
+}
+
+// GameResult ... sent with GAME OVER, the score is carried in the message Content. Answer
+// lets the client check a lost game against the game hash it was given at the start and
+// Scoring names the strategy the score was calculated with. Round numbers the games played
+// in the session from 1 and Total is the sum of their scores, including this one. Race is
+// only set at the end of a race.
+type GameResult struct {
+	Outcome Outcome
+	Answer  string      `json:",omitempty"`
+	Scoring string      `json:",omitempty"`
+	Round   int         `json:",omitempty"`
+	Total   int         `json:",omitempty"`
+	Race    *RaceResult `json:",omitempty"`
+}
+
+// OpponentStatus ... sent in an OPPONENT message during a race, once when the players are
+// paired and again whenever the opponent guesses, so each player can follow the other's
+// progress without seeing their guesses. Name is the opponent's identity if they
+// authenticated. Revealed counts the letters the opponent has found out of the Letters in
+// the answer. Out is set once the opponent has run out of lives and Left once they've
+// disconnected.
+type OpponentStatus struct {
+	Name     string `json:",omitempty"`
+	Revealed int    `json:",omitempty"`
+	Letters  int    `json:",omitempty"`
+	Lives    int    `json:",omitempty"`
+	MaxLives int    `json:",omitempty"`
+	Out      bool   `json:",omitempty"`
+	Left     bool   `json:",omitempty"`
+}
+
+// RaceResult ... sent with the GAME OVER that ends a race to both players, how the
+// opponent's game ended and what they scored.
+type RaceResult struct {
+	Opponent string `json:",omitempty"`
+	Outcome  Outcome
+	Score    int `json:",omitempty"`
+}
+
+// RoundResult ... the result of one game played in a session.
+type RoundResult struct {
+	Outcome Outcome
+	Answer  string
+	Score   int
+}
+
+// SessionSummary ... sent with SUMMARY when the client quits, every game finished in the
+// session in the order they were played and the total of their scores.
+type SessionSummary struct {
+	Rounds []RoundResult `json:",omitempty"`
+	Total  int
+}
+
+// String ... formats the GameSettings for logs.
+func (s GameSettings) String() string {
+	return fmt.Sprintf("difficulty %q, %d-%d letters, %d lives, race %t", s.Difficulty, s.MinLength, s.MaxLength, s.Lives, s.Race)
+}
+
+// String ... formats the GameStatus for logs.
+func (s GameStatus) String() string {
+	if s.Alphabet != nil {
+		return fmt.Sprintf("lives %d/%d, guessed %q, %s alphabet", s.Lives, s.MaxLives, s.Guessed, s.Alphabet)
+	}
+	return fmt.Sprintf("lives %d/%d, guessed %q", s.Lives, s.MaxLives, s.Guessed)
+}
+
+// String ... formats the GameResult for logs.
+func (r GameResult) String() string {
+	if r.Race != nil {
+		return fmt.Sprintf("%s, answer %q, %s scoring, round %d, total %d, %s", r.Outcome, r.Answer, r.Scoring, r.Round, r.Total, r.Race)
+	}
+	return fmt.Sprintf("%s, answer %q, %s scoring, round %d, total %d", r.Outcome, r.Answer, r.Scoring, r.Round, r.Total)
+}
+
+// String ... formats the OpponentStatus for logs.
+func (s OpponentStatus) String() string {
+	return fmt.Sprintf("opponent %q, %d/%d letters, lives %d/%d, out %t, left %t", s.Name, s.Revealed, s.Letters, s.Lives, s.MaxLives, s.Out, s.Left)
+}
+
+// String ... formats the RaceResult for logs.
+func (r RaceResult) String() string {
+	return fmt.Sprintf("opponent %q %s with %d", r.Opponent, r.Outcome, r.Score)
+}
+
+// String ... formats the SessionSummary for logs.
+func (s SessionSummary) String() string {
+	return fmt.Sprintf("%d rounds, total %d", len(s.Rounds), s.Total)
+}
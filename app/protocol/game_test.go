@@ -0,0 +1,32 @@
+package protocol
+
+import "testing"
+
+func TestParseGameSettings(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    GameSettings
+		wantErr bool
+	}{
+		{text: "", want: GameSettings{}},
+		{text: "hard", want: GameSettings{Difficulty: DifficultyHard}},
+		{text: "easy, lives=3", want: GameSettings{Difficulty: DifficultyEasy, Lives: 3}},
+		{text: "min=4,max=6", want: GameSettings{MinLength: 4, MaxLength: 6}},
+		{text: "impossible", wantErr: true},
+		{text: "min=0", wantErr: true},
+		{text: "max=six", wantErr: true},
+		{text: "min=6,max=4", wantErr: true},
+		{text: "speed=2", wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.text, func(t *testing.T) {
+			got, err := ParseGameSettings(test.text)
+			if (err != nil) != test.wantErr {
+				t.Fatalf("ParseGameSettings(%q) error = %v, want error %v", test.text, err, test.wantErr)
+			}
+			if !test.wantErr && got != test.want {
+				t.Fatalf("ParseGameSettings(%q) = %+v, want %+v", test.text, got, test.want)
+			}
+		})
+	}
+}
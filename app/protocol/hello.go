@@ -0,0 +1,146 @@
+package protocol
+
+// hello contains the HELLO exchange that begins every connection. The client offers the
+// protocol versions, cipher suites and features it supports, the server picks a version,
+// a suite and the features both sides support, and both sides speak that version of the
+// protocol for the rest of the connection. HELLOs are part of the handshake transcript, so
+// a negotiation tampered with in transit fails once the session key is set.
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Version ... a version of the hangmango protocol.
+type Version uint16
+
+// Version1 ... the handshake, framing and message types described in the readme.
+const Version1 Version = 1
+
+// SupportedVersions ... every version of the protocol this package speaks, newest first.
+var SupportedVersions = []Version{Version1}
+
+// Suite ... names the key exchange and cipher used to establish and protect a session.
+type Suite string
+
+const (
+	// SuiteECDHE ... an ephemeral X25519 key agreement signed by the server's RSA key
+	// (ECDHEREQ and ECDHERESP), followed by AES-256-GCM.
+	SuiteECDHE Suite = "ECDHE-X25519-RSA-AES-256-GCM"
+	// SuiteRSA ... a session key chosen by the server and sent RSA-OAEP encrypted (PUBKEYREQ,
+	// PUBKEYRESP, SYMKEYREQ and SYMKEYRESP), followed by AES-256-GCM.
+	SuiteRSA Suite = "RSA-OAEP-AES-256-GCM"
+)
+
+// Feature ... names an optional part of the protocol.
+type Feature string
+
+const (
+	// FeatureRekey ... either side may replace the key it sends with in a REKEY message.
+	FeatureRekey Feature = "rekey"
+	// FeatureClientAuth ... the client may authenticate with a certificate in a CLIENTAUTH message.
+	FeatureClientAuth Feature = "clientauth"
+	// FeatureRounds ... the client may play further games after GAME OVER with NEW GAME and
+	// end the session with QUIT.
+	FeatureRounds Feature = "rounds"
+	// FeatureRace ... the client may ask to race another player with GameSettings.Race and
+	// understands OPPONENT messages.
+	FeatureRace Feature = "race"
+)
+
+// Hello ... carried by a HELLO message. The client lists everything it supports in order of
+// preference, the server replies with the single version and suite it chose and the features
+// both sides will use. Sessions over a SecureTransport don't negotiate a suite.
+type Hello struct {
+	Versions []Version `json:",omitempty"`
+	Suites   []Suite   `json:",omitempty"`
+	Features []Feature `json:",omitempty"`
+}
+
+// Version ... returns the first version in the Hello, which is the negotiated version in a reply.
+func (h Hello) Version() Version {
+	if len(h.Versions) == 0 {
+		return 0
+	}
+	return h.Versions[0]
+}
+
+// Suite ... returns the first suite in the Hello, which is the negotiated suite in a reply.
+func (h Hello) Suite() Suite {
+	if len(h.Suites) == 0 {
+		return ""
+	}
+	return h.Suites[0]
+}
+
+// Has ... reports whether feature is listed in the Hello.
+func (h Hello) Has(feature Feature) bool {
+	return slices.Contains(h.Features, feature)
+}
+
+// String ... formats the Hello for logs.
+func (h Hello) String() string {
+	return fmt.Sprintf("versions %v, suites %v, features %v", h.Versions, h.Suites, h.Features)
+}
+
+// NegotiationError ... returned when the client and server have no version or suite in common,
+// or a server's reply picks something the client didn't offer.
+type NegotiationError struct {
+	Reason string
+}
+
+func (e *NegotiationError) Error() string {
+	return fmt.Sprintf("negotiation failed - %s", e.Reason)
+}
+
+// Negotiate ... returns the server's reply to the client's offer, given what the server
+// supports. The newest common version is chosen, along with the client's most preferred
+// suite the server supports. No suite is chosen if the server doesn't list any.
+func Negotiate(offer Hello, supported Hello) (Hello, error) {
+	var selected Hello
+	for _, version := range supported.Versions {
+		if slices.Contains(offer.Versions, version) && version > selected.Version() {
+			selected.Versions = []Version{version}
+		}
+	}
+	if len(selected.Versions) == 0 {
+		return Hello{}, &NegotiationError{Reason: fmt.Sprintf("no protocol version in common, offered %v and supported %v", offer.Versions, supported.Versions)}
+	}
+	if len(supported.Suites) > 0 {
+		for _, suite := range offer.Suites {
+			if slices.Contains(supported.Suites, suite) {
+				selected.Suites = []Suite{suite}
+				break
+			}
+		}
+		if len(selected.Suites) == 0 {
+			return Hello{}, &NegotiationError{Reason: fmt.Sprintf("no cipher suite in common, offered %v and supported %v", offer.Suites, supported.Suites)}
+		}
+	}
+	for _, feature := range supported.Features {
+		if offer.Has(feature) {
+			selected.Features = append(selected.Features, feature)
+		}
+	}
+	return selected, nil
+}
+
+// Check ... verifies the server's reply to the offer chose exactly one version and at most
+// one suite, and only things that were offered.
+func (offer Hello) Check(selected Hello) error {
+	if len(selected.Versions) != 1 || !slices.Contains(offer.Versions, selected.Version()) {
+		return &NegotiationError{Reason: fmt.Sprintf("server chose version %v, offered %v", selected.Versions, offer.Versions)}
+	}
+	if len(selected.Suites) > 1 || (len(selected.Suites) == 1 && !slices.Contains(offer.Suites, selected.Suite())) {
+		return &NegotiationError{Reason: fmt.Sprintf("server chose suite %v, offered %v", selected.Suites, offer.Suites)}
+	}
+	if len(offer.Suites) > 0 && len(selected.Suites) == 0 {
+		return &NegotiationError{Reason: "server didn't choose a cipher suite"}
+	}
+	for _, feature := range selected.Features {
+		if !offer.Has(feature) {
+			return &NegotiationError{Reason: fmt.Sprintf("server chose feature %q, which wasn't offered", feature)}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package protocol
+
+// Kind ... identifies the purpose of a Message. Hangman application messages
+// (guesses and hints) carry an empty Kind.
+type Kind string
+
+const (
+	// KindHello ... client offers the versions, suites and features it supports, the
+	// server replies with the ones it chose.
+	KindHello Kind = "HELLO"
+	// KindHangman ... a guess from the client or a hint from the server.
+	KindHangman Kind = ""
+	// KindPubKeyReq ... client provides its RSA public key and requests the servers.
+	KindPubKeyReq Kind = "PUBKEYREQ"
+	// KindPubKeyResp ... server provides its RSA public key.
+	KindPubKeyResp Kind = "PUBKEYRESP"
+	// KindSymKeyReq ... client requests a symmetric key for the session.
+	KindSymKeyReq Kind = "SYMKEYREQ"
+	// KindSymKeyResp ... server provides the AES-GCM key for the session.
+	KindSymKeyResp Kind = "SYMKEYRESP"
+	// KindECDHEReq ... client provides its ephemeral X25519 key share.
+	KindECDHEReq Kind = "ECDHEREQ"
+	// KindECDHEResp ... server provides its ephemeral X25519 key share, signed along with the clients.
+	KindECDHEResp Kind = "ECDHERESP"
+	// KindRekey ... either party replaces the AES-GCM key for the messages it sends.
+	KindRekey Kind = "REKEY"
+	// KindClientAuth ... client presents its certificate and proves possession of its key.
+	KindClientAuth Kind = "CLIENTAUTH"
+	// KindAlreadyGuessed ... server tells the client the guess in Content was made before,
+	// it costs nothing and the game carries on.
+	KindAlreadyGuessed Kind = "ALREADY GUESSED"
+	// KindGameOver ... server reports the final score and outcome of a game.
+	KindGameOver Kind = "GAME OVER"
+	// KindNewGame ... client starts another game in the same session after GAME OVER.
+	KindNewGame Kind = "NEW GAME"
+	// KindQuit ... client ends the session, the server replies with a SUMMARY.
+	KindQuit Kind = "QUIT"
+	// KindSummary ... server lists every game played in the session, then closes the connection.
+	KindSummary Kind = "SUMMARY"
+	// KindOpponent ... server reports the progress of the client's opponent in a race.
+	KindOpponent Kind = "OPPONENT"
+	// KindError ... the sender is closing the connection, Code says why and Content
+	// carries a readable reason.
+	KindError Kind = "ERROR"
+	// KindRejected ... the server refused a message but the connection stays open, Code
+	// says why and Content carries a readable reason.
+	KindRejected Kind = "REJECTED"
+)
+
+// StartGame ... Content of the hangman message a client sends to begin a game.
+const StartGame = "START GAME"
+
+// Message ... plaintext representation of every message in the protocol.
+// Hash carries the game hash described in the readme and Signature carries
+// the servers signature over both key shares in an ECDHERESP, or the clients
+// signature over the session's channel binding in a CLIENTAUTH.
+// KeyID names the server signing key, sent by the client in HELLO, PUBKEYREQ and ECDHEREQ
+// for the certificate it holds and by the server in HELLO, PUBKEYRESP and ECDHERESP for the
+// key it signed with. Certificate carries the server's certificate for that key in
+// HELLO, PUBKEYRESP and ECDHERESP, so clients can follow key rotation. Code is only set
+// in ERROR and REJECTED, and Hello only in HELLO. Status is sent with every hint and
+// ALREADY GUESSED, and Result with GAME OVER. Settings may be sent with START GAME or NEW
+// GAME, in which case the server echoes the settings it chose with the first hint. Summary
+// is only sent with SUMMARY and Opponent only with OPPONENT.
+type Message struct {
+	Mtype       Kind            `json:",omitempty"`
+	Content     []byte          `json:",omitempty"`
+	Hash        []byte          `json:",omitempty"`
+	Signature   []byte          `json:",omitempty"`
+	KeyID       string          `json:",omitempty"`
+	Certificate []byte          `json:",omitempty"`
+	Code        ErrorCode       `json:",omitempty"`
+	Hello       *Hello          `json:",omitempty"`
+	Status      *GameStatus     `json:",omitempty"`
+	Result      *GameResult     `json:",omitempty"`
+	Settings    *GameSettings   `json:",omitempty"`
+	Summary     *SessionSummary `json:",omitempty"`
+	Opponent    *OpponentStatus `json:",omitempty"`
+}
+
+// EncryptedMessage ... Maintains two fields, A is the encrypted message and the other
+// is the MAC validation/signature field. During the handshake B holds an RSA-PSS
+// signature from the server. Once a symmetric key is established B is empty and S holds
+// the sequence number of the message in its direction of travel, which the GCM nonce
+// is built from.
+type EncryptedMessage struct {
+	A []byte `json:"A,omitempty"`
+	B []byte `json:"B,omitempty"`
+	S uint64 `json:"S,omitempty"`
+}
@@ -0,0 +1,427 @@
+package protocol
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"math"
+	"sync"
+)
+
+// channelBindingLabel ... domain separates the channel binding from other uses of the session key.
+const channelBindingLabel = "hangmango client auth v1"
+
+// Labels bound into the GCM additional data of each message along with its sequence number,
+// so a message can't be reflected back to the side that sent it.
+const (
+	clientToServerLabel = "hangmango client to server"
+	serverToClientLabel = "hangmango server to client"
+)
+
+// SessionConfig ... key material used by a Session.
+type SessionConfig struct {
+	// LocalKey decrypts RSA-OAEP messages addressed to this side of the connection.
+	LocalKey *rsa.PrivateKey
+	// SigningKey signs every message sent before a symmetric key is established.
+	// Only the server holds a signing key.
+	SigningKey *rsa.PrivateKey
+	// VerificationKey verifies the signature on every message received before a
+	// symmetric key is established. Clients use the public key of the server certificate.
+	VerificationKey *rsa.PublicKey
+	// VerifyCertificate is called with the Certificate of a plaintext handshake message
+	// before its signature is checked. If it returns a key, that key replaces VerificationKey,
+	// so a client can accept a rotated server key whose certificate it trusts.
+	VerifyCertificate func(certificate []byte) (*rsa.PublicKey, error)
+	// Server is set for the server side of the connection.
+	Server bool
+	// SecureTransport is set when the connection is already protected, for example by TLS.
+	// The handshake is skipped and messages are carried as plaintext JSON.
+	SecureTransport bool
+	// RekeyAfterMessages and RekeyAfterBytes limit how much is sent under one AES-GCM key
+	// before RekeyDue reports a new one is needed, DefaultRekeyAfterMessages and
+	// DefaultRekeyAfterBytes are used when they're zero. Peers that send twice as much
+	// without rekeying are rejected.
+	RekeyAfterMessages uint64
+	RekeyAfterBytes    uint64
+}
+
+// Session ... tracks the state of the encrypted channel for a single connection.
+// Messages are sent in plaintext until EnableEncryption is called, RSA-OAEP encrypted
+// to the peer until SetSymmetricKey is called and AES-GCM encrypted from then on.
+// Sessions over a SecureTransport are established from the start and never encrypt.
+// AES-GCM messages carry a sequence number per direction, starting from zero when the
+// symmetric key is set, which Open requires to increase by exactly one with each message
+// so replayed, dropped or reordered messages are detected. Each direction is encrypted
+// with its own key, which the sender replaces with a REKEY message when RekeyDue.
+// A Session is safe for concurrent use.
+type Session struct {
+	mu           sync.Mutex
+	config       SessionConfig
+	peerKey      *rsa.PublicKey
+	encrypted    bool
+	symmetricKey []byte
+	send         *cipherState
+	recv         *cipherState
+	sendSequence uint64
+	recvSequence uint64
+	// transcript hashes every handshake message in the order they were sent or received,
+	// its digest is bound into every AES-GCM message along with the game hash, if set.
+	transcript     hash.Hash
+	transcriptHash []byte
+	gameHash       []byte
+	// negotiated is the server's HELLO, nil until the HELLO exchange is complete.
+	negotiated *Hello
+}
+
+// NewSession ... returns a Session in its initial plaintext state.
+func NewSession(config SessionConfig) *Session {
+	return &Session{config: config, transcript: sha256.New()}
+}
+
+// EnableEncryption ... records the peers public key, all following messages in both
+// directions are RSA-OAEP encrypted until a symmetric key is set.
+func (s *Session) EnableEncryption(peerKey *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.peerKey = peerKey
+	s.encrypted = true
+}
+
+// SetServerKeys ... replaces the keys the server side of the session decrypts and signs
+// handshake messages with, used once the client has said which server key it trusts.
+func (s *Session) SetServerKeys(localKey *rsa.PrivateKey, signingKey *rsa.PrivateKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config.LocalKey = localKey
+	s.config.SigningKey = signingKey
+}
+
+// VerificationKey ... returns the key the server's handshake signatures are verified with.
+func (s *Session) VerificationKey() *rsa.PublicKey {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.config.VerificationKey
+}
+
+// SetNegotiated ... records the version, suite and features chosen in the server's HELLO.
+// A session that has negotiated without FeatureRekey refuses to send or accept REKEY.
+func (s *Session) SetNegotiated(hello Hello) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.negotiated = &hello
+}
+
+// Negotiated ... returns the version, suite and features chosen in the server's HELLO and
+// whether the HELLO exchange is complete.
+func (s *Session) Negotiated() (Hello, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.negotiated == nil {
+		return Hello{}, false
+	}
+	return *s.negotiated, true
+}
+
+// Version ... returns the negotiated protocol version, or zero before the HELLO exchange.
+func (s *Session) Version() Version {
+	hello, _ := s.Negotiated()
+	return hello.Version()
+}
+
+// rekeyAllowed ... reports whether REKEY may be used, the caller must hold s.mu.
+func (s *Session) rekeyAllowed() bool {
+	return s.negotiated == nil || s.negotiated.Has(FeatureRekey)
+}
+
+// SetSymmetricKey ... switches the session to AES-GCM with a key for each direction derived
+// from key, sequence numbers in both directions start again from zero.
+func (s *Session) SetSymmetricKey(key []byte) error {
+	if len(key) != SymmetricKeySize {
+		return &ProtocolError{Reason: fmt.Sprintf("session key is %d bytes, expected %d", len(key), SymmetricKeySize)}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	send, err := s.directionCipher(key, s.config.Server)
+	if err != nil {
+		return err
+	}
+	recv, err := s.directionCipher(key, !s.config.Server)
+	if err != nil {
+		return err
+	}
+	s.symmetricKey = key
+	s.send, s.recv = send, recv
+	s.transcriptHash = s.transcript.Sum(nil)
+	s.encrypted = true
+	s.sendSequence = 0
+	s.recvSequence = 0
+	return nil
+}
+
+// directionCipher ... returns the cipherState for messages sent by the server if fromServer
+// is set, or by the client otherwise.
+func (s *Session) directionCipher(sessionKey []byte, fromServer bool) (*cipherState, error) {
+	key, err := deriveDirectionKey(sessionKey, fromServer)
+	if err != nil {
+		return nil, err
+	}
+	return newCipherState(key)
+}
+
+// rekeyLimits ... returns the number of messages and bytes sent under a key before it's replaced.
+func (s *Session) rekeyLimits() (uint64, uint64) {
+	messages, bytes := s.config.RekeyAfterMessages, s.config.RekeyAfterBytes
+	if messages == 0 {
+		messages = DefaultRekeyAfterMessages
+	}
+	if bytes == 0 {
+		bytes = DefaultRekeyAfterBytes
+	}
+	return messages, bytes
+}
+
+// SetGameHash ... binds every AES-GCM message sealed or opened from now on to the game
+// identified by hash, so messages can't be spliced between games. The server sets it
+// after sending the first hint of a game and the client after receiving it.
+func (s *Session) SetGameHash(hash []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.gameHash = append([]byte(nil), hash...)
+}
+
+// RekeyDue ... reports whether the key messages are being sent with has reached its limits
+// and should be replaced by sending the frame returned by Rekey before anything else.
+func (s *Session) RekeyDue() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.send == nil {
+		return false
+	}
+	return s.send.exceeds(s.rekeyLimits())
+}
+
+// Rekey ... generates a new key for the messages we send and returns a REKEY frame carrying
+// it, sealed under the current key so the peer knows it came from us. Every message sealed
+// after the frame uses the new key.
+func (s *Session) Rekey() ([]byte, error) {
+	key, err := GenerateSymmetricKey()
+	if err != nil {
+		return nil, err
+	}
+	send, err := newCipherState(key)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.send == nil {
+		return nil, fmt.Errorf("no session key to replace")
+	}
+	if !s.rekeyAllowed() {
+		return nil, fmt.Errorf("rekeying wasn't negotiated")
+	}
+	frame, err := s.seal(Message{Mtype: KindRekey, Content: key})
+	if err != nil {
+		return nil, err
+	}
+	s.send = send
+	return frame, nil
+}
+
+// Encrypted ... reports whether messages are being encrypted.
+func (s *Session) Encrypted() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.encrypted
+}
+
+// Established ... reports whether a symmetric key has been set or the transport is secure,
+// in either case the session is ready for hangman messages.
+func (s *Session) Established() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.symmetricKey) > 0 || s.config.SecureTransport
+}
+
+// SecureTransport ... reports whether the session relies on the transport for protection.
+func (s *Session) SecureTransport() bool {
+	return s.config.SecureTransport
+}
+
+// ChannelBinding ... returns a value unique to this session's symmetric key that a client
+// signs in a CLIENTAUTH message, so the signature can't be replayed in another session.
+// It returns nil until a symmetric key has been set.
+func (s *Session) ChannelBinding() []byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.symmetricKey) == 0 {
+		return nil
+	}
+	binding := sha256.New()
+	binding.Write([]byte(channelBindingLabel))
+	binding.Write(s.symmetricKey)
+	return binding.Sum(nil)
+}
+
+// Seal ... marshals msg, protects it according to the current state of the session
+// and returns the JSON encoded EncryptedMessage ready to be written as a frame.
+func (s *Session) Seal(msg Message) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.seal(msg)
+}
+
+// seal ... implements Seal, the caller must hold s.mu.
+func (s *Session) seal(msg Message) ([]byte, error) {
+	plaintext, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var enc EncryptedMessage
+	if s.config.SecureTransport {
+		enc.A = plaintext
+		return json.Marshal(enc)
+	}
+	if s.send == nil {
+		s.addToTranscript(plaintext)
+	}
+	switch {
+	case s.send != nil:
+		if s.sendSequence == math.MaxUint64 {
+			return nil, fmt.Errorf("sequence numbers exhausted")
+		}
+		enc.S = s.sendSequence
+		enc.A = s.send.seal(enc.S, plaintext, s.additionalData(s.config.Server, enc.S))
+		s.sendSequence++
+	case s.encrypted:
+		enc.A, err = EncryptRSA(plaintext, s.peerKey)
+		if err != nil {
+			return nil, &CryptoError{Op: "encrypting with peer public key", Err: err}
+		}
+	default:
+		enc.A = plaintext
+	}
+
+	// Handshake messages from the server are signed so the client can verify who it's talking to.
+	if len(s.symmetricKey) == 0 && s.config.SigningKey != nil {
+		enc.B, err = Sign(enc.A, s.config.SigningKey)
+		if err != nil {
+			return nil, &CryptoError{Op: "signing message", Err: err}
+		}
+	}
+
+	return json.Marshal(enc)
+}
+
+// Open ... parses a frame produced by the peers Seal, verifies and decrypts it
+// according to the current state of the session and returns the Message within.
+func (s *Session) Open(frame []byte) (Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var msg Message
+	var enc EncryptedMessage
+	if err := json.Unmarshal(frame, &enc); err != nil {
+		return msg, fmt.Errorf("deserialising encryptedMessage - %s", err)
+	}
+	if s.config.SecureTransport {
+		if err := json.Unmarshal(enc.A, &msg); err != nil {
+			return msg, fmt.Errorf("deserialising message - %s", err)
+		}
+		return msg, nil
+	}
+
+	// A plaintext handshake message may carry a newer server certificate than the one
+	// we were configured with, it's only used if the callback trusts it.
+	if len(s.symmetricKey) == 0 && !s.encrypted && s.config.VerifyCertificate != nil {
+		if err := json.Unmarshal(enc.A, &msg); err == nil && len(msg.Certificate) > 0 {
+			key, err := s.config.VerifyCertificate(msg.Certificate)
+			if err != nil {
+				return Message{}, &CryptoError{Op: "verifying server certificate", Err: err}
+			}
+			if key != nil {
+				s.config.VerificationKey = key
+			}
+		}
+		msg = Message{}
+	}
+
+	// If data was sent before a symmetric key was established; verify the signature of the message
+	if len(s.symmetricKey) == 0 && s.config.VerificationKey != nil {
+		if err := Verify(enc.A, enc.B, s.config.VerificationKey); err != nil {
+			return msg, &CryptoError{Op: "verifying message signature", Err: err}
+		}
+	}
+
+	var plaintext []byte
+	var err error
+	switch {
+	case len(s.symmetricKey) > 0:
+		if enc.S != s.recvSequence {
+			return msg, &ProtocolError{Reason: fmt.Sprintf("received sequence number %d, expected %d - message replayed, dropped or reordered", enc.S, s.recvSequence)}
+		}
+		if messages, bytes := s.rekeyLimits(); s.recv.exceeds(2*messages, 2*bytes) {
+			return msg, &ProtocolError{Reason: "peer exceeded the limits of its key without rekeying"}
+		}
+		plaintext, err = s.recv.open(enc.S, enc.A, s.additionalData(!s.config.Server, enc.S))
+		if err != nil {
+			return msg, &ProtocolError{Reason: fmt.Sprintf("message %d failed authentication, it was modified in transit or belongs to another session or game - %s", enc.S, err)}
+		}
+		s.recvSequence++
+	case s.encrypted:
+		plaintext, err = DecryptRSA(enc.A, s.config.LocalKey)
+		if err != nil {
+			return msg, &CryptoError{Op: "decrypting with local private key", Err: err}
+		}
+	default:
+		plaintext = enc.A
+	}
+
+	if err := json.Unmarshal(plaintext, &msg); err != nil {
+		return msg, fmt.Errorf("deserialising message - %s", err)
+	}
+	if s.recv == nil {
+		s.addToTranscript(plaintext)
+	}
+	// The peer has replaced the key it sends with, the key isn't passed on to the caller.
+	if msg.Mtype == KindRekey && s.recv != nil {
+		if !s.rekeyAllowed() {
+			return msg, &ProtocolError{Reason: "REKEY received but rekeying wasn't negotiated"}
+		}
+		if len(msg.Content) != SymmetricKeySize {
+			return msg, &ProtocolError{Reason: "REKEY carries a key of the wrong size"}
+		}
+		recv, err := newCipherState(msg.Content)
+		if err != nil {
+			return msg, err
+		}
+		s.recv = recv
+		msg.Content = nil
+	}
+	return msg, nil
+}
+
+// addToTranscript ... adds the plaintext of a handshake message to the transcript, length
+// prefixed so the boundaries between messages are part of the digest.
+func (s *Session) addToTranscript(plaintext []byte) {
+	s.transcript.Write(binary.BigEndian.AppendUint64(nil, uint64(len(plaintext))))
+	s.transcript.Write(plaintext)
+}
+
+// additionalData ... returns the GCM additional data for the message with sequence number
+// seq, sent by the server if fromServer is set or by the client otherwise. It binds the
+// message to its direction, its position in the session, the handshake that established
+// the session and the current game.
+func (s *Session) additionalData(fromServer bool, seq uint64) []byte {
+	label := clientToServerLabel
+	if fromServer {
+		label = serverToClientLabel
+	}
+	ad := binary.BigEndian.AppendUint64([]byte(label), seq)
+	ad = append(ad, s.transcriptHash...)
+	return append(ad, s.gameHash...)
+}
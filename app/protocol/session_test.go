@@ -0,0 +1,271 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// newSessionPair ... returns a client and a server session with the given configs that share
+// a symmetric key.
+func newSessionPair(t *testing.T, clientConfig SessionConfig, serverConfig SessionConfig) (*Session, *Session) {
+	t.Helper()
+	key, err := GenerateSymmetricKey()
+	if err != nil {
+		t.Fatalf("GenerateSymmetricKey() error = %v", err)
+	}
+	serverConfig.Server = true
+	client, server := NewSession(clientConfig), NewSession(serverConfig)
+	for _, session := range []*Session{client, server} {
+		if err := session.SetSymmetricKey(key); err != nil {
+			t.Fatalf("SetSymmetricKey() error = %v", err)
+		}
+	}
+	return client, server
+}
+
+// sealGuesses ... seals count guesses from sender, the i'th guessing the i'th letter.
+func sealGuesses(t *testing.T, sender *Session, count int) [][]byte {
+	t.Helper()
+	frames := make([][]byte, count)
+	for i := range frames {
+		frame, err := sender.Seal(Message{Content: []byte{byte('a' + i)}})
+		if err != nil {
+			t.Fatalf("Seal() error = %v", err)
+		}
+		frames[i] = frame
+	}
+	return frames
+}
+
+// tamper ... flips a bit of the ciphertext in frame.
+func tamper(t *testing.T, frame []byte) []byte {
+	t.Helper()
+	var enc EncryptedMessage
+	if err := json.Unmarshal(frame, &enc); err != nil {
+		t.Fatalf("unmarshalling frame - %v", err)
+	}
+	enc.A[len(enc.A)/2] ^= 0x01
+	tampered, err := json.Marshal(enc)
+	if err != nil {
+		t.Fatalf("marshalling frame - %v", err)
+	}
+	return tampered
+}
+
+// wantProtocolError ... fails the test unless err is a ProtocolError.
+func wantProtocolError(t *testing.T, err error) {
+	t.Helper()
+	var protocolErr *ProtocolError
+	if !errors.As(err, &protocolErr) {
+		t.Fatalf("Open() error = %v, want a ProtocolError", err)
+	}
+}
+
+func TestOpenSequence(t *testing.T) {
+	tests := []struct {
+		name      string
+		deliver   []int
+		tampered  int
+		reflected bool
+		// fails is the position in deliver of the frame Open should reject, or -1.
+		fails int
+	}{
+		{name: "in order", deliver: []int{0, 1, 2}, tampered: -1, fails: -1},
+		{name: "replayed", deliver: []int{0, 1, 1}, tampered: -1, fails: 2},
+		{name: "replayed after later frames", deliver: []int{0, 1, 2, 0}, tampered: -1, fails: 3},
+		{name: "out of order", deliver: []int{1, 0}, tampered: -1, fails: 0},
+		{name: "dropped", deliver: []int{0, 2}, tampered: -1, fails: 1},
+		{name: "tampered", deliver: []int{0, 1}, tampered: 1, fails: 1},
+		{name: "reflected to the sender", deliver: []int{0}, tampered: -1, reflected: true, fails: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newSessionPair(t, SessionConfig{}, SessionConfig{})
+			frames := sealGuesses(t, client, 3)
+			if test.tampered >= 0 {
+				frames[test.tampered] = tamper(t, frames[test.tampered])
+			}
+			receiver := server
+			if test.reflected {
+				receiver = client
+			}
+			for position, i := range test.deliver {
+				msg, err := receiver.Open(frames[i])
+				if position == test.fails {
+					wantProtocolError(t, err)
+					return
+				}
+				if err != nil {
+					t.Fatalf("Open() of frame %d error = %v", i, err)
+				}
+				if want := string(rune('a' + i)); string(msg.Content) != want {
+					t.Fatalf("Open() of frame %d = %q, want %q", i, msg.Content, want)
+				}
+			}
+			if test.fails >= 0 {
+				t.Fatalf("frame %d was accepted", test.deliver[test.fails])
+			}
+		})
+	}
+}
+
+func TestRekey(t *testing.T) {
+	rekey := &Hello{Versions: SupportedVersions, Features: []Feature{FeatureRekey}}
+	noRekey := &Hello{Versions: SupportedVersions}
+	tests := []struct {
+		name         string
+		clientHello  *Hello
+		serverHello  *Hello
+		wantRekeyErr bool
+		wantOpenErr  bool
+	}{
+		{name: "negotiated", clientHello: rekey, serverHello: rekey},
+		{name: "before negotiation", clientHello: nil, serverHello: nil},
+		{name: "not negotiated", clientHello: noRekey, serverHello: noRekey, wantRekeyErr: true},
+		{name: "not negotiated by the receiver", clientHello: rekey, serverHello: noRekey, wantOpenErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newSessionPair(t, SessionConfig{}, SessionConfig{})
+			if test.clientHello != nil {
+				client.SetNegotiated(*test.clientHello)
+			}
+			if test.serverHello != nil {
+				server.SetNegotiated(*test.serverHello)
+			}
+			frames := sealGuesses(t, client, 1)
+			frame, err := client.Rekey()
+			if test.wantRekeyErr {
+				if err == nil {
+					t.Fatal("Rekey() succeeded without the rekey feature")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Rekey() error = %v", err)
+			}
+			frames = append(frames, frame)
+			frames = append(frames, sealGuesses(t, client, 2)...)
+
+			for i, frame := range frames {
+				msg, err := server.Open(frame)
+				if test.wantOpenErr && i == 1 {
+					wantProtocolError(t, err)
+					return
+				}
+				if err != nil {
+					t.Fatalf("Open() of frame %d error = %v", i, err)
+				}
+				if i == 1 && (msg.Mtype != KindRekey || msg.Content != nil) {
+					t.Fatalf("Open() of the REKEY frame = %q with content %q, want %q without the key", msg.Mtype, msg.Content, KindRekey)
+				}
+			}
+		})
+	}
+}
+
+func TestRekeyLimits(t *testing.T) {
+	tests := []struct {
+		name        string
+		clientLimit uint64
+		serverLimit uint64
+		sent        int
+		rekey       bool
+		wantDue     bool
+		// rejected is the number of the message the server should reject, or -1.
+		rejected int
+	}{
+		{name: "under the limit", clientLimit: 4, serverLimit: 4, sent: 3, rejected: -1},
+		{name: "at the limit", clientLimit: 4, serverLimit: 4, sent: 4, wantDue: true, rejected: -1},
+		{name: "rekeyed when due", clientLimit: 4, serverLimit: 4, sent: 18, rekey: true, rejected: -1},
+		{name: "peer ignores the limit", serverLimit: 4, sent: 20, rejected: 8},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, server := newSessionPair(t, SessionConfig{RekeyAfterMessages: test.clientLimit}, SessionConfig{RekeyAfterMessages: test.serverLimit})
+			for i := 0; i < test.sent; i++ {
+				if test.rekey && client.RekeyDue() {
+					frame, err := client.Rekey()
+					if err != nil {
+						t.Fatalf("Rekey() error = %v", err)
+					}
+					if _, err := server.Open(frame); err != nil {
+						t.Fatalf("Open() of REKEY error = %v", err)
+					}
+				}
+				frame, err := client.Seal(Message{Content: []byte("a")})
+				if err != nil {
+					t.Fatalf("Seal() error = %v", err)
+				}
+				_, err = server.Open(frame)
+				if i == test.rejected {
+					wantProtocolError(t, err)
+					return
+				}
+				if err != nil {
+					t.Fatalf("Open() of message %d error = %v", i, err)
+				}
+			}
+			if test.rejected >= 0 {
+				t.Fatalf("message %d was accepted", test.rejected)
+			}
+			if got := client.RekeyDue(); got != test.wantDue {
+				t.Fatalf("RekeyDue() = %v, want %v", got, test.wantDue)
+			}
+		})
+	}
+}
+
+func TestOpenAdditionalData(t *testing.T) {
+	game, otherGame := []byte("game one"), []byte("game two")
+	tests := []struct {
+		name       string
+		clientHash []byte
+		serverHash []byte
+		// diverged has the client seal a handshake message the server never opens, so their
+		// transcripts differ.
+		diverged bool
+		wantErr  bool
+	}{
+		{name: "no game"},
+		{name: "same game", clientHash: game, serverHash: game},
+		{name: "mismatched game", clientHash: game, serverHash: otherGame, wantErr: true},
+		{name: "game set by the sender only", clientHash: game, wantErr: true},
+		{name: "game set by the receiver only", serverHash: game, wantErr: true},
+		{name: "mismatched transcript", clientHash: game, serverHash: game, diverged: true, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			key, err := GenerateSymmetricKey()
+			if err != nil {
+				t.Fatalf("GenerateSymmetricKey() error = %v", err)
+			}
+			client, server := NewSession(SessionConfig{}), NewSession(SessionConfig{Server: true})
+			if test.diverged {
+				if _, err := client.Seal(Message{Mtype: KindSymKeyReq}); err != nil {
+					t.Fatalf("Seal() error = %v", err)
+				}
+			}
+			for _, session := range []*Session{client, server} {
+				if err := session.SetSymmetricKey(key); err != nil {
+					t.Fatalf("SetSymmetricKey() error = %v", err)
+				}
+			}
+			if test.clientHash != nil {
+				client.SetGameHash(test.clientHash)
+			}
+			if test.serverHash != nil {
+				server.SetGameHash(test.serverHash)
+			}
+			_, err = server.Open(sealGuesses(t, client, 1)[0])
+			if test.wantErr {
+				wantProtocolError(t, err)
+				return
+			}
+			if err != nil {
+				t.Fatalf("Open() error = %v", err)
+			}
+		})
+	}
+}
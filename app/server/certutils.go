@@ -1,36 +1,89 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
-	"crypto/sha256"
+	"crypto/tls"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"flag"
+	"fmt"
 	"log"
 	"math/big"
 	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
+// Paths of the certificates and keys the server generates on first run. The CA paths
+// can be changed with -cacert and -cakey so the CA can be kept apart from the server.
+var (
+	certificatePath   = "./app/server/hangmango.crt"
+	signingKeyPath    = "./app/server/hangmango-signing.pem"
+	caCertificatePath = "./app/server/hangmango-ca.crt"
+	caKeyPath         = "./app/server/hangmango-ca.pem"
+)
+
+// serverHostnames ... comma separated DNS names and IP addresses the server certificate is issued
+// for, which clients check against the host they dial. Set with -hostnames.
+var serverHostnames = "localhost,127.0.0.1,::1"
+
+// renewBefore ... the server certificate is reissued by the CA when it expires within this window.
+const renewBefore = 30 * 24 * time.Hour
+
+// addCAFlags ... registers the flags that locate the CA on flags.
+func addCAFlags(flags *flag.FlagSet) {
+	flags.StringVar(&caCertificatePath, "cacert", caCertificatePath, "Path of the CA certificate that issues server and client certificates.")
+	flags.StringVar(&caKeyPath, "cakey", caKeyPath, "Path of the CA private key. Only needed when a certificate has to be issued or renewed.")
+}
+
+// addHostnamesFlag ... registers the flag that sets the names the server certificate is issued for on flags.
+func addHostnamesFlag(flags *flag.FlagSet) {
+	flags.StringVar(&serverHostnames, "hostnames", serverHostnames, "Comma separated DNS names and IP addresses clients use to reach the server, included in its certificate.")
+}
+
+// parseHostnames ... splits a comma separated list of hostnames into the DNS names and IP
+// addresses to include in a certificate.
+func parseHostnames(list string) ([]string, []net.IP, error) {
+	var names []string
+	var ips []net.IP
+	for _, host := range strings.Split(list, ",") {
+		host = strings.TrimSpace(host)
+		if host == "" {
+			continue
+		}
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+			continue
+		}
+		if strings.ContainsAny(host, " /:") {
+			return nil, nil, fmt.Errorf("%q is not a valid DNS name or IP address", host)
+		}
+		names = append(names, strings.ToLower(host))
+	}
+	if len(names) == 0 && len(ips) == 0 {
+		return nil, nil, fmt.Errorf("at least one hostname is required")
+	}
+	return names, ips, nil
+}
+
+// initialiseSigning ... returns the private key used to sign messages from the server, making sure
+// a CA and a current server certificate issued by it for that key exist on disk first.
 func initialiseSigning() rsa.PrivateKey {
-	// caStruct represents the root certificate of the authority chain.
-	caStruct := generateCAStruct()
-	caPrivKey := generateCASigningPair(caStruct)
-	// certStruct represents the certificate to be provided to clients.
-	certStruct := generateCertStruct()
-	return generateCert(certStruct, caStruct, caPrivKey)
+	key := initialiseSigningKey()
+	ensureServerCertificate(key, false)
+	return *key
 }
 
 // generateCA ... returns an x509.Certificate struct
 func generateCAStruct() x509.Certificate {
 	ca := x509.Certificate{
-		SerialNumber: big.NewInt(2020),
+		SerialNumber: randomSerialNumber(),
 		Subject: pkix.Name{
+			CommonName:    "Hangmango Root CA",
 			Organization:  []string{"UNECOSC540"},
 			Country:       []string{"AUS"},
 			Province:      []string{"ACT"},
@@ -46,58 +99,79 @@ func generateCAStruct() x509.Certificate {
 		BasicConstraintsValid: true,
 	}
 	return ca
-	// generateCASigningPair(ca)
 }
 
-func generateCASigningPair(ca x509.Certificate) *rsa.PrivateKey {
-	certPath := "./app/server/hangmango.crt"
-	keyPath := "./app/server/hangmango-signing.pem"
-
-	if !fileExists(keyPath) && !fileExists(certPath) {
-		log.Printf("- CRYPTO - Generating keypair for CA...")
-		size := 2048
-		caKey, err := rsa.GenerateKey(rand.Reader, size)
+// initialiseCA ... loads the CA from disk, generating and persisting a new one if neither its
+// certificate nor its key exist. The key is nil when only the CA certificate is present, which
+// is enough to run the server but not to issue certificates.
+func initialiseCA() (*x509.Certificate, *rsa.PrivateKey) {
+	if !fileExists(caCertificatePath) && !fileExists(caKeyPath) {
+		log.Printf("- CRYPTO - No CA at %s and %s - Generating keypair for CA...", caCertificatePath, caKeyPath)
+		caKey, err := rsa.GenerateKey(rand.Reader, 2048)
 		if err != nil {
 			log.Printf("- CRYPTO - CA keypair generation error - %s", err)
+			os.Exit(1)
 		}
-		err = caKey.Validate()
-		if err != nil {
-			log.Printf("- CRYPTO - CA keypair generation error -  key failed to validate - %s", err)
-		}
-
-		// Signs the certificate struct ca with the specified keys, also returns byte slice representation
-		// of the ca.
-		caBytes, err := x509.CreateCertificate(rand.Reader, &ca, &ca, &caKey.PublicKey, caKey)
+		caStruct := generateCAStruct()
+		// Self sign the CA, also returns byte slice representation of the ca.
+		caBytes, err := x509.CreateCertificate(rand.Reader, &caStruct, &caStruct, &caKey.PublicKey, caKey)
 		if err != nil {
 			log.Printf("- CRYPTO - failed to create CA certificate - %s", err)
+			os.Exit(1)
+		}
+		if err := writeRSAPrivateKey(caKeyPath, caKey); err != nil {
+			log.Printf("- CRYPTO - failed to write CA private key %s - %s", caKeyPath, err)
+			os.Exit(1)
 		}
+		if err := writePEMFile(caCertificatePath, "CERTIFICATE", caBytes); err != nil {
+			log.Printf("- CRYPTO - failed to write CA certificate %s - %s", caCertificatePath, err)
+			os.Exit(1)
+		}
+		log.Printf("- CRYPTO - CA generated, distribute %s with clients as their root of trust.", caCertificatePath)
+	}
 
-		// Unused
-		caPEM := new(bytes.Buffer)
-		pem.Encode(caPEM, &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: caBytes,
-		})
+	ca, caKey, err := loadCA()
+	if err != nil && ca == nil {
+		log.Printf("- CRYPTO - Failed to load the CA - %s", err)
+		os.Exit(1)
+	}
+	return ca, caKey
+}
 
-		// Unused
-		caPrivKeyPEM := new(bytes.Buffer)
-		pem.Encode(caPrivKeyPEM, &pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(caKey),
-		})
-		return caKey
+// initialiseSigningKey ... loads the key used to sign messages from the server, generating
+// and persisting a new one if it doesn't exist.
+func initialiseSigningKey() *rsa.PrivateKey {
+	if !fileExists(signingKeyPath) {
+		log.Printf("- CRYPTO - No existing file at %s - Generating keypair for signatures...", signingKeyPath)
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			log.Printf("- CRYPTO - signing keypair generation error - %s", err)
+			os.Exit(1)
+		}
+		if err := writeRSAPrivateKey(signingKeyPath, key); err != nil {
+			log.Printf("- CRYPTO - failed to write signing private key %s - %s", signingKeyPath, err)
+			os.Exit(1)
+		}
+		return key
 	}
-	return nil
+	log.Printf("- CRYPTO - Loading certificate private key to sign messages outbound from the server.")
+	key, err := readRSAPrivateKey(signingKeyPath)
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		os.Exit(1)
+	}
+	return key
 }
 
 // generateCertStruct ... returns a struct containing the metadata
 // of the certificates to be distributed with hangmango clients
-// With this certificate installed, only servers running on localhost with
-// reference to the client can be communicated with.
-func generateCertStruct() x509.Certificate {
+// With this certificate installed, clients can only communicate with servers
+// reached through one of the DNS names or IP addresses in -hostnames.
+func generateCertStruct(names []string, ips []net.IP) x509.Certificate {
 	cert := x509.Certificate{
-		SerialNumber: big.NewInt(2001),
+		SerialNumber: randomSerialNumber(),
 		Subject: pkix.Name{
+			CommonName:    "hangmango server",
 			Organization:  []string{"UNECOSC540"},
 			Country:       []string{"AUS"},
 			Province:      []string{"ACT"},
@@ -105,108 +179,186 @@ func generateCertStruct() x509.Certificate {
 			StreetAddress: []string{""},
 			PostalCode:    []string{""},
 		},
-		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
-		NotBefore:    time.Now(),
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3},
-		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:     x509.KeyUsageDigitalSignature,
+		DNSNames:    names,
+		IPAddresses: ips,
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(1, 0, 0),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
 	}
 	return cert
 }
 
-// generateCert ... Provided a root certificate and its provided key, sign the struct of the x509 certificate
-// provided in the first argument. Function also writes out the certificate and private key object (containing priv and pub key)
-// from the to certPath and keyPath. The private key is to be used to sign messages from the server, and the certificate is
-// to be distributed with clients.
-func generateCert(cert x509.Certificate, ca x509.Certificate, caKey *rsa.PrivateKey) rsa.PrivateKey {
-	certPath := "./app/server/hangmango.crt"
-	keyPath := "./app/server/hangmango-signing.pem"
+// ensureServerCertificate ... makes sure the server certificate on disk was issued by the CA for
+// key, covers -hostnames and isn't about to expire, issuing a new one from the CA if it doesn't
+// or if force is set.
+// The old certificate is kept if it's still valid but the CA key isn't available to renew it.
+func ensureServerCertificate(key *rsa.PrivateKey, force bool) {
+	names, ips, err := parseHostnames(serverHostnames)
+	if err != nil {
+		log.Printf("- ERROR - Invalid -hostnames - %s", err)
+		os.Exit(1)
+	}
+	ca, caKey := initialiseCA()
 
-	if !fileExists(keyPath) && !fileExists(certPath) {
-		log.Printf("- CRYPTO - No existing file at %s and %s - Generating keypair for signatures...", certPath, keyPath)
-		size := 2048
-		certKey, err := rsa.GenerateKey(rand.Reader, size)
-		if err != nil {
-			log.Printf("- CRYPTO - signing keypair generation error - %s", err)
+	reason, usable := "renewal was requested", false
+	if !force {
+		reason, usable = serverCertificateProblem(ca, key, append(names, ipStrings(ips)...))
+		if reason == "" {
+			return
 		}
-		err = certKey.Validate()
-		if err != nil {
-			log.Printf("- CRYPTO - signing keypair generation error -  key failed to validate - %s", err)
-		}
-
-		certBytes, err := x509.CreateCertificate(rand.Reader, &cert, &ca, &certKey.PublicKey, caKey)
-		if err != nil {
-			log.Printf("- CRYPTO - failed to create server certificate - %s", err)
+	}
+	if caKey == nil {
+		if !usable {
+			log.Printf("- CRYPTO - Server certificate needs to be issued because %s, but the CA key at %s isn't available.", reason, caKeyPath)
 			os.Exit(1)
 		}
+		log.Printf("- CRYPTO - Server certificate %s should be renewed because %s, but the CA key at %s isn't available.", certificatePath, reason, caKeyPath)
+		return
+	}
 
-		log.Printf("- CRYPTO - Keys generated, writing private key to file.")
+	log.Printf("- CRYPTO - Issuing server certificate %s from the CA because %s...", certificatePath, reason)
+	certStruct := generateCertStruct(names, ips)
+	certBytes, err := x509.CreateCertificate(rand.Reader, &certStruct, ca, &key.PublicKey, caKey)
+	if err != nil {
+		log.Printf("- CRYPTO - failed to create server certificate - %s", err)
+		os.Exit(1)
+	}
+	if err := writePEMFile(certificatePath, "CERTIFICATE", certBytes); err != nil {
+		log.Printf("- CRYPTO - failed to encode signing certificate %s - %s", certificatePath, err)
+		os.Exit(1)
+	}
+	log.Printf("- CRYPTO - Server certificate issued, valid until %s.", certStruct.NotAfter.Format(time.RFC3339))
+}
 
-		certPrivKeyFile, err := os.Create(keyPath)
-		if err != nil {
-			log.Printf(" - CRYPTO - failed to open handle to %s - %s", keyPath, err)
-			os.Exit(1)
+// serverCertificateProblem ... returns why the server certificate on disk needs to be issued
+// again, or an empty string if it's current, and whether it can still be used in the meantime.
+func serverCertificateProblem(ca *x509.Certificate, key *rsa.PrivateKey, hostnames []string) (string, bool) {
+	if !fileExists(certificatePath) {
+		return "it doesn't exist", false
+	}
+	block, err := readPEMFile(certificatePath)
+	if err != nil {
+		return err.Error(), false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Sprintf("it can't be parsed - %s", err), false
+	}
+	if err := cert.CheckSignatureFrom(ca); err != nil {
+		return "it wasn't issued by the current CA", false
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return "it doesn't match the signing key", false
+	}
+	if time.Now().After(cert.NotAfter) {
+		return "it has expired", false
+	}
+	for _, host := range hostnames {
+		if cert.VerifyHostname(host) != nil {
+			return fmt.Sprintf("it isn't valid for %s", host), true
 		}
+	}
+	if time.Now().Add(renewBefore).After(cert.NotAfter) {
+		return "it expires soon", true
+	}
+	return "", true
+}
 
-		err = pem.Encode(certPrivKeyFile, &pem.Block{
-			Type:  "RSA PRIVATE KEY",
-			Bytes: x509.MarshalPKCS1PrivateKey(certKey),
-		})
-		if err != nil {
-			log.Printf(" - CRYPTO - failed to encode cert private key %s - %s", keyPath, err)
-			os.Exit(1)
-		}
-		certPrivKeyFile.Close()
+// ipStrings ... returns the string form of each address in ips.
+func ipStrings(ips []net.IP) []string {
+	hosts := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		hosts = append(hosts, ip.String())
+	}
+	return hosts
+}
 
-		certFile, err := os.Create(certPath)
-		if err != nil {
-			log.Printf(" - CRYPTO - failed to open handle to %s - %s", certPath, err)
-			os.Exit(1)
-		}
+// randomSerialNumber ... returns a random 128 bit certificate serial number.
+func randomSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		os.Exit(1)
+	}
+	return serial
+}
 
-		err = pem.Encode(certFile, &pem.Block{
-			Type:  "CERTIFICATE",
-			Bytes: certBytes,
-		})
-		if err != nil {
-			log.Printf("- CRYPTO - failed to encode signing certificate %s - %s", certPath, err)
-			os.Exit(1)
-		}
-		certFile.Close()
+// loadTLSConfig ... returns a TLS config that presents the certificate distributed with
+// clients, proven with the signing key, for use with the -tls flag. The certificate is
+// replaced when the keys are reloaded.
+func loadTLSConfig(certificate []byte, key *rsa.PrivateKey) *tls.Config {
+	tlsCertificate.Store(&tls.Certificate{Certificate: [][]byte{certificate}, PrivateKey: key})
+	return &tls.Config{
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return tlsCertificate.Load(), nil
+		},
+		MinVersion: tls.VersionTLS12,
+	}
+}
 
-		// Super hacky but provides the flow that we're after.
-		log.Printf("- CRYPTO - Keypairs and certificate generated. Hangmango is closing, please restart to bundle the certificate with clients.")
-		os.Exit(1)
+// loadCACertificate ... reads the persisted CA certificate from disk, without its key.
+func loadCACertificate() (*x509.Certificate, error) {
+	certBlock, err := readPEMFile(caCertificatePath)
+	if err != nil {
+		return nil, err
+	}
+	ca, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s - %s", caCertificatePath, err)
+	}
+	return ca, nil
+}
 
-		return *certKey
-	} else {
-		log.Printf("- CRYPTO - cert and key already exist. Loading certificate private key to sign messages outbound from the server.")
-		// Private key used for signing is already on disk, we'll use that to sign our messages from the server
-		certPrivKeyFile, err := os.Open(keyPath)
-		if err != nil {
-			log.Printf("- CRYPTO - Expected to read from %s but failed to open handle - %s", keyPath, err)
-			os.Exit(1)
-		}
-		pemfileinfo, _ := certPrivKeyFile.Stat()
-		var size int64 = pemfileinfo.Size()
-		pembytes := make([]byte, size)
-		buffer := bufio.NewReader(certPrivKeyFile)
-		_, err = buffer.Read(pembytes)
-		data, _ := pem.Decode([]byte(pembytes))
-		certPrivKeyFile.Close()
-
-		key, err := x509.ParsePKCS1PrivateKey(data.Bytes)
-		if err != nil {
-			log.Printf("- CRYPTO - Failed to unmarshal private key object from %s bytes - %s", keyPath, err)
-			os.Exit(1)
-		}
-		err = key.Validate()
-		if err != nil {
-			log.Printf("- CRYPTO - key failed to validate - %s", err)
-		}
-		return *key
+// loadCA ... reads the persisted CA certificate and private key from disk. If only the
+// certificate could be read it's returned along with the error loading the key.
+func loadCA() (*x509.Certificate, *rsa.PrivateKey, error) {
+	ca, err := loadCACertificate()
+	if err != nil {
+		return nil, nil, err
+	}
+	caKey, err := readRSAPrivateKey(caKeyPath)
+	if err != nil {
+		return ca, nil, err
+	}
+	if !caKey.PublicKey.Equal(ca.PublicKey) {
+		return ca, nil, fmt.Errorf("%s doesn't match %s", caKeyPath, caCertificatePath)
+	}
+	return ca, caKey, nil
+}
+
+// readPEMFile ... returns the first PEM block in the file at path.
+func readPEMFile(path string) (*pem.Block, error) {
+	pembytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(pembytes)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data found in %s", path)
 	}
+	return block, nil
+}
+
+// writePEMFile ... PEM encodes der as a block of blockType and writes it to path,
+// only readable by the current user. The file is replaced atomically so an existing
+// key or certificate isn't lost if writing fails part way.
+func writePEMFile(path string, blockType string, der []byte) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = pem.Encode(file, &pem.Block{Type: blockType, Bytes: der})
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
 }
 
 func fileExists(filename string) bool {
@@ -216,16 +368,3 @@ func fileExists(filename string) bool {
 	}
 	return !info.IsDir()
 }
-
-// Sign ... signs data with rsa-sha256 and populates the B field of
-// an encryptedMessage type.
-func (enc *encryptedMessage) Sign(privkey *rsa.PrivateKey) {
-	hash := sha256.New()
-	hash.Write(enc.A)
-	hashed := hash.Sum(nil)
-	signature, err := rsa.SignPSS(rand.Reader, privkey, crypto.SHA256, hashed, nil)
-	if err != nil {
-		os.Exit(1)
-	}
-	enc.B = signature
-}
@@ -0,0 +1,107 @@
+package main
+
+// clientcerts contains the issue-client-cert subcommand, which uses the persisted CA
+// to issue certificates that hangmango clients authenticate themselves with.
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"log"
+	"math/big"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// regexpClientName ... names are used in file names, so they're limited to a safe character set.
+var regexpClientName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// issueClientCert ... parses the arguments of the issue-client-cert subcommand and
+// writes a client certificate and key signed by the CA to the output directory.
+// Returns the exit code for the process.
+func issueClientCert(args []string) int {
+	flags := flag.NewFlagSet("issue-client-cert", flag.ExitOnError)
+	flagName := flags.String("name", "", "Name of the player, recorded as the certificate's common name. (required)")
+	flagOut := flags.String("out", "./app/client", "Directory to write <name>.crt and <name>-key.pem to.")
+	flagDays := flags.Int("days", 365, "Number of days the certificate is valid for.")
+	addCAFlags(flags)
+	addPassphraseFlag(flags)
+	flags.Parse(args)
+
+	if !regexpClientName.MatchString(*flagName) {
+		log.Printf("- ERROR - -name is required and may only contain letters, digits, '-' and '_'")
+		return 1
+	}
+	if *flagDays < 1 {
+		log.Printf("- ERROR - -days must be at least 1")
+		return 1
+	}
+
+	ca, caKey, err := loadCA()
+	if err != nil {
+		log.Printf("- CRYPTO - Unable to load the CA, run init-certs to generate one - %s", err)
+		return 1
+	}
+
+	log.Printf("- CRYPTO - Generating keypair for client %s...", *flagName)
+	clientKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Printf("- CRYPTO - client keypair generation error - %s", err)
+		return 1
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		return 1
+	}
+	template := x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:   *flagName,
+			Organization: []string{"UNECOSC540"},
+		},
+		NotBefore:   time.Now(),
+		NotAfter:    time.Now().AddDate(0, 0, *flagDays),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		KeyUsage:    x509.KeyUsageDigitalSignature,
+	}
+	certBytes, err := x509.CreateCertificate(rand.Reader, &template, ca, &clientKey.PublicKey, caKey)
+	if err != nil {
+		log.Printf("- CRYPTO - failed to create client certificate - %s", err)
+		return 1
+	}
+
+	certPath := filepath.Join(*flagOut, *flagName+".crt")
+	keyPath := filepath.Join(*flagOut, *flagName+"-key.pem")
+	if fileExists(certPath) || fileExists(keyPath) {
+		log.Printf("- ERROR - Refusing to overwrite existing %s or %s", certPath, keyPath)
+		return 1
+	}
+	if err := writePEMFile(keyPath, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(clientKey)); err != nil {
+		log.Printf("- CRYPTO - failed to write client private key %s - %s", keyPath, err)
+		return 1
+	}
+	if err := writePEMFile(certPath, "CERTIFICATE", certBytes); err != nil {
+		log.Printf("- CRYPTO - failed to write client certificate %s - %s", certPath, err)
+		return 1
+	}
+	log.Printf("- CRYPTO - Issued a certificate for %s, valid until %s - %s and %s", *flagName, template.NotAfter.Format(time.RFC3339), certPath, keyPath)
+	return 0
+}
+
+// loadClientCAs ... returns a pool containing the persisted CA for verifying client
+// certificates, or nil if the CA isn't available. Only the CA certificate is read, the
+// CA's private key is only needed to issue certificates.
+func loadClientCAs() *x509.CertPool {
+	ca, err := loadCACertificate()
+	if err != nil {
+		log.Printf("- CRYPTO - Unable to load the CA for client authentication - %s", err)
+		return nil
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool
+}
@@ -0,0 +1,97 @@
+package main
+
+// commands contains the subcommands hangmanserver accepts in place of its usual flags,
+// for managing certificates without starting the server.
+
+import (
+	"flag"
+	"log"
+	"os"
+)
+
+// initCerts ... parses the arguments of the init-certs and renew-cert subcommands, then makes
+// sure the CA, signing key and server certificate exist, reissuing the server certificate
+// from the CA if renew is set. Returns the exit code for the process.
+func initCerts(name string, args []string, renew bool) int {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	addCAFlags(flags)
+	addHostnamesFlag(flags)
+	addPassphraseFlag(flags)
+	flags.Parse(args)
+
+	key := initialiseSigningKey()
+	ensureServerCertificate(key, renew)
+	initialiseEncryption()
+	log.Printf("- CRYPTO - Certificates ready, distribute %s and %s with clients.", caCertificatePath, certificatePath)
+	return 0
+}
+
+// encryptKeys ... parses the arguments of the encrypt-keys subcommand and rewrites each of the
+// server's private keys that is stored in cleartext encrypted with the passphrase. Returns the
+// exit code for the process.
+func encryptKeys(args []string) int {
+	flags := flag.NewFlagSet("encrypt-keys", flag.ExitOnError)
+	addCAFlags(flags)
+	addPassphraseFlag(flags)
+	flags.Parse(args)
+
+	secret, err := passphrase(true)
+	if err != nil {
+		log.Printf("- ERROR - %s", err)
+		return 1
+	}
+	if secret == nil {
+		log.Printf("- ERROR - %s", errNoPassphrase)
+		return 1
+	}
+
+	status := 0
+	for _, path := range []string{encryptionKeyPath, signingKeyPath, caKeyPath} {
+		if !fileExists(path) {
+			continue
+		}
+		encrypted, err := isEncryptedKeyFile(path)
+		if err != nil {
+			log.Printf("- CRYPTO - %s", err)
+			status = 1
+			continue
+		}
+		if encrypted {
+			log.Printf("- CRYPTO - %s is already encrypted.", path)
+			continue
+		}
+		key, err := readRSAPrivateKey(path)
+		if err != nil {
+			log.Printf("- CRYPTO - %s", err)
+			status = 1
+			continue
+		}
+		if err := writeRSAPrivateKey(path, key); err != nil {
+			log.Printf("- CRYPTO - failed to write encrypted private key %s - %s", path, err)
+			status = 1
+			continue
+		}
+		log.Printf("- CRYPTO - Encrypted %s.", path)
+	}
+	return status
+}
+
+// exitOnSubcommand ... runs the subcommand named by the first argument, if there is one,
+// and exits with its result.
+func exitOnSubcommand() {
+	if len(os.Args) < 2 {
+		return
+	}
+	switch os.Args[1] {
+	case "issue-client-cert":
+		os.Exit(issueClientCert(os.Args[2:]))
+	case "init-certs":
+		os.Exit(initCerts(os.Args[1], os.Args[2:], false))
+	case "renew-cert":
+		os.Exit(initCerts(os.Args[1], os.Args[2:], true))
+	case "encrypt-keys":
+		os.Exit(encryptKeys(os.Args[2:]))
+	case "rotate-keys":
+		os.Exit(rotateKeys(os.Args[2:]))
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+// keystore reads and writes the server's private keys. When a passphrase is available keys
+// are stored as PKCS8 encrypted with PBES2, using PBKDF2-HMAC-SHA256 to derive an AES-256-CBC
+// key from the passphrase, the same format as `openssl pkcs8 -topk8 -v2 aes256`. PBKDF2 isn't
+// memory-hard like scrypt, but it's in the standard library, which is all the server depends on.
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"flag"
+	"fmt"
+	"hash"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// passphraseEnv ... environment variable the key passphrase can be supplied in.
+const passphraseEnv = "HANGMANGO_KEY_PASSPHRASE"
+
+// pbkdf2Iterations ... work factor for keys written by the server, OWASP's recommendation
+// for PBKDF2-HMAC-SHA256.
+const pbkdf2Iterations = 600000
+
+// maxPBKDF2Iterations ... keys asking for more work than this are rejected rather than
+// stalling startup.
+const maxPBKDF2Iterations = 10000000
+
+// passphraseFile ... path of a file containing the key passphrase. Set with -passphrase-file.
+var passphraseFile = ""
+
+// keyPassphrase ... the passphrase once it has been read, and whether reading has been attempted.
+var keyPassphrase []byte
+var keyPassphraseRead bool
+
+// errNoPassphrase ... returned when an encrypted key is read without a passphrase source.
+var errNoPassphrase = errors.New("no passphrase supplied, use -passphrase-file, $" + passphraseEnv + " or run from a terminal")
+
+// errIncorrectPassphrase ... returned when an encrypted key can't be decrypted with the passphrase.
+var errIncorrectPassphrase = errors.New("incorrect passphrase")
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA1   = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 7}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES128CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 2}
+	oidAES192CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 22}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// encryptedPrivateKeyInfo ... ASN.1 structure of an "ENCRYPTED PRIVATE KEY" PEM block (RFC 5958).
+type encryptedPrivateKeyInfo struct {
+	Algorithm     pkix.AlgorithmIdentifier
+	EncryptedData []byte
+}
+
+// pbes2Params ... parameters of the PBES2 encryption scheme (RFC 8018).
+type pbes2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+// pbkdf2Params ... parameters of the PBKDF2 key derivation function (RFC 8018).
+type pbkdf2Params struct {
+	Salt           []byte
+	IterationCount int
+	KeyLength      int                      `asn1:"optional"`
+	PRF            pkix.AlgorithmIdentifier `asn1:"optional"`
+}
+
+// addPassphraseFlag ... registers the flag that locates the key passphrase on flags.
+func addPassphraseFlag(flags *flag.FlagSet) {
+	flags.StringVar(&passphraseFile, "passphrase-file", passphraseFile, "Path to a file containing the passphrase that protects the server's private keys. Read from $"+passphraseEnv+" or prompted for when not set.")
+}
+
+// passphrase ... returns the key passphrase from -passphrase-file, the environment or a
+// terminal prompt, in that order, or nil if none of them are available. The passphrase is
+// only read once; when it's prompted for and confirm is set it has to be entered twice.
+func passphrase(confirm bool) ([]byte, error) {
+	if keyPassphraseRead {
+		return keyPassphrase, nil
+	}
+	var secret []byte
+	switch {
+	case passphraseFile != "":
+		contents, err := os.ReadFile(passphraseFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading passphrase file - %s", err)
+		}
+		secret = bytes.TrimRight(contents, "\r\n")
+	case os.Getenv(passphraseEnv) != "":
+		secret = []byte(os.Getenv(passphraseEnv))
+	case isTerminal(os.Stdin):
+		entered, err := promptPassphrase("Enter passphrase for the hangmango server keys: ")
+		if err != nil {
+			return nil, err
+		}
+		if confirm {
+			again, err := promptPassphrase("Confirm passphrase: ")
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(entered, again) {
+				return nil, errors.New("passphrases don't match")
+			}
+		}
+		secret = entered
+	default:
+		keyPassphraseRead = true
+		return nil, nil
+	}
+	if len(secret) == 0 {
+		return nil, errors.New("passphrase is empty")
+	}
+	keyPassphrase, keyPassphraseRead = secret, true
+	return keyPassphrase, nil
+}
+
+// isTerminal ... reports whether file is an interactive terminal. Character devices such as
+// /dev/null aren't terminals, so stty is asked to confirm.
+func isTerminal(file *os.File) bool {
+	info, err := file.Stat()
+	if err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	cmd := exec.Command("stty", "-g")
+	cmd.Stdin = file
+	return cmd.Run() == nil
+}
+
+// promptPassphrase ... prints prompt and reads a line from the terminal without echoing it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	if setEcho(false) == nil {
+		defer setEcho(true)
+	}
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("reading passphrase - %s", err)
+	}
+	return []byte(strings.TrimRight(line, "\r\n")), nil
+}
+
+// setEcho ... turns terminal echo on or off with stty.
+func setEcho(on bool) error {
+	mode := "-echo"
+	if on {
+		mode = "echo"
+	}
+	cmd := exec.Command("stty", mode)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// readRSAPrivateKey ... reads a PEM encoded RSA private key from path, which may be PKCS1,
+// PKCS8 or passphrase encrypted PKCS8.
+func readRSAPrivateKey(path string) (*rsa.PrivateKey, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		secret, perr := passphrase(false)
+		if perr != nil {
+			return nil, perr
+		}
+		if secret == nil {
+			return nil, fmt.Errorf("%s is encrypted - %s", path, errNoPassphrase)
+		}
+		var der []byte
+		der, err = decryptPKCS8(block.Bytes, secret)
+		if err == nil {
+			if parsed, err = x509.ParsePKCS8PrivateKey(der); err != nil {
+				err = errIncorrectPassphrase
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt %s - %s", path, err)
+		}
+	default:
+		return nil, fmt.Errorf("%s contains a %s, not a private key", path, block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal private key object from %s bytes - %s", path, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't contain an RSA private key", path)
+	}
+	if err := key.Validate(); err != nil {
+		return nil, fmt.Errorf("key in %s failed to validate - %s", path, err)
+	}
+	return key, nil
+}
+
+// isEncryptedKeyFile ... reports whether the key at path is already passphrase encrypted.
+func isEncryptedKeyFile(path string) (bool, error) {
+	block, err := readPEMFile(path)
+	if err != nil {
+		return false, err
+	}
+	return block.Type == "ENCRYPTED PRIVATE KEY", nil
+}
+
+// writeRSAPrivateKey ... writes key to path, encrypted with the passphrase if one is available.
+// Without a passphrase the key is written in cleartext PKCS1 and can be encrypted later with
+// the encrypt-keys subcommand.
+func writeRSAPrivateKey(path string, key *rsa.PrivateKey) error {
+	secret, err := passphrase(true)
+	if err != nil {
+		return err
+	}
+	if secret == nil {
+		log.Printf("- CRYPTO - No passphrase supplied, %s is stored unencrypted - Run encrypt-keys to protect it.", path)
+		return writePEMFile(path, "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key))
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	encrypted, err := encryptPKCS8(der, secret)
+	if err != nil {
+		return err
+	}
+	return writePEMFile(path, "ENCRYPTED PRIVATE KEY", encrypted)
+}
+
+// encryptPKCS8 ... encrypts a PKCS8 private key with secret, returning the DER of an
+// EncryptedPrivateKeyInfo.
+func encryptPKCS8(der []byte, secret []byte) ([]byte, error) {
+	salt := make([]byte, 16)
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	if _, err := rand.Read(iv); err != nil {
+		return nil, err
+	}
+	key, err := pbkdf2.Key(sha256.New, string(secret), salt, pbkdf2Iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	padding := aes.BlockSize - len(der)%aes.BlockSize
+	ciphertext := append(append([]byte{}, der...), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, ciphertext)
+
+	kdfParams, err := asn1.Marshal(pbkdf2Params{
+		Salt:           salt,
+		IterationCount: pbkdf2Iterations,
+		PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return nil, err
+	}
+	ivParam, err := asn1.Marshal(iv)
+	if err != nil {
+		return nil, err
+	}
+	schemeParams, err := asn1.Marshal(pbes2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: kdfParams}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivParam}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(encryptedPrivateKeyInfo{
+		Algorithm:     pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: schemeParams}},
+		EncryptedData: ciphertext,
+	})
+}
+
+// decryptPKCS8 ... decrypts the DER of an EncryptedPrivateKeyInfo with secret, returning the
+// PKCS8 private key. Only PBES2 with PBKDF2 and AES-CBC is supported.
+func decryptPKCS8(der []byte, secret []byte) ([]byte, error) {
+	var info encryptedPrivateKeyInfo
+	if rest, err := asn1.Unmarshal(der, &info); err != nil || len(rest) != 0 {
+		return nil, errors.New("malformed encrypted private key")
+	}
+	if !info.Algorithm.Algorithm.Equal(oidPBES2) {
+		return nil, fmt.Errorf("unsupported key encryption %s", info.Algorithm.Algorithm)
+	}
+	var scheme pbes2Params
+	if _, err := asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &scheme); err != nil {
+		return nil, errors.New("malformed PBES2 parameters")
+	}
+	if !scheme.KeyDerivationFunc.Algorithm.Equal(oidPBKDF2) {
+		return nil, fmt.Errorf("unsupported key derivation function %s", scheme.KeyDerivationFunc.Algorithm)
+	}
+	var kdf pbkdf2Params
+	if _, err := asn1.Unmarshal(scheme.KeyDerivationFunc.Parameters.FullBytes, &kdf); err != nil {
+		return nil, errors.New("malformed PBKDF2 parameters")
+	}
+	if kdf.IterationCount < 1 || kdf.IterationCount > maxPBKDF2Iterations {
+		return nil, fmt.Errorf("unsupported PBKDF2 iteration count %d", kdf.IterationCount)
+	}
+	var prf func() hash.Hash
+	switch {
+	case kdf.PRF.Algorithm == nil, kdf.PRF.Algorithm.Equal(oidHMACWithSHA1):
+		prf = sha1.New
+	case kdf.PRF.Algorithm.Equal(oidHMACWithSHA256):
+		prf = sha256.New
+	default:
+		return nil, fmt.Errorf("unsupported PBKDF2 hash %s", kdf.PRF.Algorithm)
+	}
+	var keySize int
+	switch {
+	case scheme.EncryptionScheme.Algorithm.Equal(oidAES128CBC):
+		keySize = 16
+	case scheme.EncryptionScheme.Algorithm.Equal(oidAES192CBC):
+		keySize = 24
+	case scheme.EncryptionScheme.Algorithm.Equal(oidAES256CBC):
+		keySize = 32
+	default:
+		return nil, fmt.Errorf("unsupported cipher %s", scheme.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(scheme.EncryptionScheme.Parameters.FullBytes, &iv); err != nil || len(iv) != aes.BlockSize {
+		return nil, errors.New("malformed AES-CBC parameters")
+	}
+	if len(info.EncryptedData) == 0 || len(info.EncryptedData)%aes.BlockSize != 0 {
+		return nil, errors.New("malformed encrypted data")
+	}
+
+	key, err := pbkdf2.Key(prf, string(secret), kdf.Salt, kdf.IterationCount, keySize)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, info.EncryptedData)
+
+	// A wrong passphrase almost always shows up as invalid padding.
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize {
+		return nil, errIncorrectPassphrase
+	}
+	for _, b := range plaintext[len(plaintext)-padding:] {
+		if int(b) != padding {
+			return nil, errIncorrectPassphrase
+		}
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
@@ -0,0 +1,94 @@
+package main
+
+// rotation contains the rotate-keys subcommand, which replaces the server's keys on disk,
+// and the SIGHUP handler that loads them into a running server without a restart.
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/tgmars/hangmango/app/hangmango"
+)
+
+// tlsCertificate ... the certificate presented to TLS clients, replaced when keys are reloaded.
+var tlsCertificate atomic.Pointer[tls.Certificate]
+
+// rotateKeys ... parses the arguments of the rotate-keys subcommand, generates new encryption
+// and signing keys and issues a certificate for the signing key from the CA. A running server
+// picks them up when it receives SIGHUP. Returns the exit code for the process.
+func rotateKeys(args []string) int {
+	flags := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	addCAFlags(flags)
+	addHostnamesFlag(flags)
+	addPassphraseFlag(flags)
+	flags.Parse(args)
+
+	// Check the CA can issue the new certificate before replacing any keys.
+	if _, caKey, err := loadCA(); caKey == nil {
+		log.Printf("- CRYPTO - Keys can't be rotated without the CA key - %s", err)
+		return 1
+	}
+
+	log.Printf("- CRYPTO - Generating new encryption and signing keys...")
+	encryptionKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		return 1
+	}
+	signingKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		return 1
+	}
+	if err := writeRSAPrivateKey(encryptionKeyPath, encryptionKey); err != nil {
+		log.Printf("- CRYPTO - failed to write encryption private key %s - %s", encryptionKeyPath, err)
+		return 1
+	}
+	if err := writeRSAPrivateKey(signingKeyPath, signingKey); err != nil {
+		log.Printf("- CRYPTO - failed to write signing private key %s - %s", signingKeyPath, err)
+		return 1
+	}
+	ensureServerCertificate(signingKey, true)
+	log.Printf("- CRYPTO - Keys rotated, send SIGHUP to the running server to start using them.")
+	return 0
+}
+
+// loadServerKeys ... reads the encryption key, signing key and server certificate from disk
+// without generating anything, returning the certificate as DER.
+func loadServerKeys() (*rsa.PrivateKey, *rsa.PrivateKey, []byte, error) {
+	encryptionKey, err := readRSAPrivateKey(encryptionKeyPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	signingKey, err := readRSAPrivateKey(signingKeyPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	block, err := readPEMFile(certificatePath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if block.Type != "CERTIFICATE" {
+		return nil, nil, nil, fmt.Errorf("%s contains a %s, not a certificate", certificatePath, block.Type)
+	}
+	return encryptionKey, signingKey, block.Bytes, nil
+}
+
+// reloadKeys ... loads the keys on disk into server, keeping the current keys if they can't be read.
+func reloadKeys(server *hangmango.Server) {
+	log.Println("- CRYPTO - Reloading keys...")
+	encryptionKey, signingKey, certificate, err := loadServerKeys()
+	if err == nil {
+		err = server.RotateKeys(encryptionKey, signingKey, certificate)
+	}
+	if err != nil {
+		log.Printf("- CRYPTO - Failed to reload keys, keeping key %s - %s", server.KeyID(), err)
+		return
+	}
+	tlsCertificate.Store(&tls.Certificate{Certificate: [][]byte{certificate}, PrivateKey: signingKey})
+}
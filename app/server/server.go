@@ -1,197 +1,171 @@
 package main
 
 import (
-	"bufio"
-	"crypto/rsa"
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"math"
 	"net"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
-)
-
-//  clientManager ... struct that maintains
-// connected clients and channels for connection and disconnnection
-type clientManager struct {
-	clients    map[*client]bool
-	register   chan *client
-	unregister chan *client
-}
-
-// client ... struct that represents a client socket, the data channel
-// to send and receive information on, and currently unused state & guid
-type client struct {
-	socket       net.Conn
-	data         chan []byte
-	state        HangmanState
-	guid         string
-	pubkey       rsa.PublicKey
-	encrypted    bool
-	message      message
-	encmsg       encryptedMessage
-	symmetricKey []byte
-	gameHash     []byte
-}
 
-type message struct {
-	Mtype     string `json:",omitempty"`
-	Content   []byte `json:",omitempty"`
-	Hash      []byte `json:",omitempty"`
-	Signature []byte `json:",omitempty"`
-}
-
-// encryptedMessage ... Maintains two fields, A is the encrypted message and the other
-// is the MAC validation/signature field.
-type encryptedMessage struct {
-	A []byte `json:"A,omitempty"`
-	B []byte `json:"B,omitempty"`
-}
+	"github.com/tgmars/hangmango/app/hangmango"
+	"github.com/tgmars/hangmango/app/protocol"
+)
 
-// serverPrivKey and serverPubKey are RSA 2048 byte length keys
-var serverPrivKey, serverPubKey, serverPubKeyJSON = initialiseEncryption()
-var serverSignPrivKey = initialiseSigning()
+// shutdownTimeout ... how long connected clients are given to disconnect after
+// the server is asked to stop.
+const shutdownTimeout = 5 * time.Second
 
-// start ... handle connection and disconnection of clients
-// from the clientManager.
-func (manager *clientManager) start() {
-	// Keep this gorouting running for the life of execution.
-	for {
-		select {
-		case connection := <-manager.register:
-			manager.clients[connection] = true
-			log.Printf("- Client connected from %v", connection.socket.RemoteAddr())
-			// TODO: timeout the connection
+// main ... loads the servers key material from disk and runs a hangmango.Server
+// until it's interrupted.
+func main() {
+	exitOnSubcommand()
 
-		case connection := <-manager.unregister:
-			if _, ok := manager.clients[connection]; ok {
-				close(connection.data)
-				delete(manager.clients, connection)
-			}
-			manager.clients[connection] = false
-			log.Printf("- Client disconnected from %v", connection.socket.RemoteAddr())
-		}
+	// Parse flags
+	flagLPort := flag.Int("lport", 4444, "Port to listen for incoming connections on.")
+	flagLegacyPort := flag.Int("legacyport", 0, "Port to serve the unencrypted COSC540 line protocol on, for netcat and course clients. Disabled when 0.")
+	flagWordlist := flag.String("wordlist", "", "Path to a newline separated list of words or phrases to use as a valid set of answers in a hangman game. (optional)")
+	flagAlphabet := flag.String("alphabet", protocol.AlphabetEnglish.Name, "Alphabet the wordlist is written in and guesses are validated with, one of "+strings.Join(protocol.AlphabetNames(), ", ")+".")
+	flagClientAuth := flag.String("clientauth", "optional", "Client certificate authentication, one of none, optional or required.")
+	addCAFlags(flag.CommandLine)
+	addHostnamesFlag(flag.CommandLine)
+	addPassphraseFlag(flag.CommandLine)
+	flagTLS := flag.Bool("tls", false, "Serve clients over TLS with the bundled certificate instead of the hangmango handshake.")
+	flagMaxFrame := flag.Uint("maxframe", protocol.DefaultMaxFrameSize, "Maximum size in bytes of a single protocol frame sent or received.")
+	flagLives := flag.Int("lives", hangmango.DefaultLives, "Number of wrong guesses a player can make before losing a game, 0 for unlimited.")
+	flagScoring := flag.String("scoring", hangmango.DefaultScorer.Name(), "Strategy won games are scored with, one of "+strings.Join(hangmango.ScorerNames(), ", ")+".")
+	flagDropInvalid := flag.Bool("dropinvalid", true, "Disconnect clients that send a guess outside the alphabet, as the protocol requires. When false the guess is rejected and the game carries on.")
+	flagKeyOverlap := flag.Duration("keyoverlap", hangmango.DefaultKeyOverlap, "How long clients holding the previous certificate are still served with the previous keys after a SIGHUP reload.")
+	flag.Parse()
+	if *flagMaxFrame == 0 || *flagMaxFrame > math.MaxUint32 {
+		log.Printf("- ERROR - -maxframe must be between 1 and %d bytes", uint32(math.MaxUint32))
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
 	}
-}
-
-// sendData ... send data to specified client within the context of the
-// current clientManager. Flag characters are appended to the end of the
-// message array prior to sending to the client.
-func (manager *clientManager) sendData(client *client) {
-	defer client.socket.Close()
-	for {
-		select {
-		case message, ok := <-client.data:
-			// If the data channel is not OK, return, handle an error first.
-			if !ok {
-				return
-			}
-			// apply some error handling around this;
-			// message = append(message, '\n')
-			_, err := client.socket.Write(message)
-			// length, err := client.socket.Write(message)
-			if err != nil {
-				log.Println(err)
-				return
-			}
-			// if length > 0 {
-			// }
-		}
+	if *flagClientAuth != "none" && *flagClientAuth != "optional" && *flagClientAuth != "required" {
+		log.Printf("- ERROR - -clientauth must be one of none, optional or required")
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
+	}
+	scorer, err := hangmango.ScorerByName(*flagScoring)
+	if err != nil {
+		log.Printf("- ERROR - %s", err)
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
+	}
+	alphabet, err := protocol.AlphabetByName(*flagAlphabet)
+	if err != nil {
+		log.Printf("- ERROR - %s", err)
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
+	}
+	if *flagLegacyPort != 0 && *flagClientAuth == "required" {
+		log.Printf("- ERROR - -legacyport can't be used with -clientauth required, legacy clients can't authenticate")
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
 	}
-}
 
-// receiveData ... listen for incoming connections per client
-// and process data depending on whether the client.state is valid
-// or not. If state is invalid, it creates a new game for the client and responds
-// with the first hint. If state is valid, the received data is passed to hangman
-// to process the game.error
-// Implements some basic security checks & anticheat through ensuring data larger than
-// the buffers aren't parsed and catches the errors.
-func (manager *clientManager) receiveData(client *client) {
-	for {
-		// defer func() ... If we hit a panic because of slice index out of range, cleanly close the goroutine.
-		// Normaly in Go we'd try to parse the length of the message instead of using the recover()
-		// function, but it's an appropriate use for recover() because there's no way to check the
-		// length of the data at the server before it's been stored somewhere in memory.
-		defer func() {
-			if err := recover(); err != nil {
-				log.Println("- ERROR - Goroutine panicked, attempted to store too much data in message, connection closed:", err)
-				manager.unregister <- client
-				client.socket.Close()
-			}
-		}()
-		// Create a byte slice limited in length to 4096 to hold the incoming data, anything over 4096 bytes
-		// will cause the goroutine to panic, unwrapping back up the stack until we hit the defer function
-		// and the call to recover()
-		message := make([]byte, 4096)
-		length, err := client.socket.Read(message)
-		if err != nil {
-			manager.unregister <- client
-			client.socket.Close()
-			break
-		}
-		receiverLogic(client, message, length)
+	log.Println("- Loading keypairs...")
+	serverPrivKey := initialiseEncryption()
+	serverSignPrivKey := initialiseSigning()
+	certificate, err := readPEMFile(certificatePath)
+	if err != nil {
+		log.Printf("- CRYPTO - %s", err)
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
 	}
-}
 
-// parseWordlist ... Append a list of newline separated values from
-// a file specified by the path argument to the answerPool variable
-// defined in package main -> hangman.go
-func parseWordlist(path string) {
-	if path != "" {
-		file, err := os.Open(path)
-		if err != nil {
-			log.Println(err)
+	opts := []hangmango.Option{
+		hangmango.WithAddr(fmt.Sprintf(":%d", *flagLPort)),
+		hangmango.WithKeys(&serverPrivKey, &serverSignPrivKey),
+		hangmango.WithCertificate(certificate.Bytes),
+		hangmango.WithKeyOverlap(*flagKeyOverlap),
+		hangmango.WithMaxFrameSize(uint32(*flagMaxFrame)),
+		hangmango.WithDropInvalidGuesses(*flagDropInvalid),
+		hangmango.WithLives(*flagLives),
+		hangmango.WithScorer(scorer),
+		hangmango.WithAlphabet(alphabet),
+	}
+	if *flagTLS {
+		opts = append(opts, hangmango.WithTLSConfig(loadTLSConfig(certificate.Bytes, &serverSignPrivKey)))
+	}
+	if *flagClientAuth != "none" {
+		pool := loadClientCAs()
+		if pool == nil && *flagClientAuth == "required" {
+			log.Println("- SERVER - Exiting.")
+			os.Exit(1)
 		}
-		defer file.Close()
-
-		scanner := bufio.NewScanner(file)
-		for scanner.Scan() {
-			answerPool = append(answerPool, scanner.Text())
+		if pool != nil {
+			opts = append(opts, hangmango.WithClientAuth(pool, *flagClientAuth == "required"))
 		}
-
-		if err := scanner.Err(); err != nil {
+	}
+	if *flagWordlist != "" {
+		log.Println("- Parsing wordlist...")
+		file, err := os.Open(*flagWordlist)
+		if err != nil {
 			log.Println(err)
+		} else {
+			defer file.Close()
+			opts = append(opts, hangmango.WithWordlist(file))
 		}
 	}
-}
 
-func main() {
-	// Parse flags
-	flagLPort := flag.Int("lport", 4444, "Port to listen for incoming connections on.")
-	flagWordlist := flag.String("wordlist", "", "Path to a newline separated list of words to use as a valid set of answers in a hangman game. (optional)")
-	flag.Parse()
-
-	log.Println("- Parsing wordlist...")
-	parseWordlist(*flagWordlist)
-
-	log.Println("- Generating keypair...")
-
-	log.Println("- Starting server...")
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *flagLPort))
+	server, err := hangmango.NewServer(opts...)
 	if err != nil {
 		log.Printf("- ERROR - %s\n", err)
 		log.Println("- SERVER - Exiting.")
 		os.Exit(1)
-
 	}
-	log.Printf("- Started server on %d\n", *flagLPort)
-	manager := clientManager{
-		clients:    make(map[*client]bool),
-		register:   make(chan *client),
-		unregister: make(chan *client),
-	}
-	go manager.start()
-	for {
-		connection, err := listener.Accept()
+
+	// Disconnect clients cleanly when we're interrupted.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		log.Println("- SERVER - Shutting down...")
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Printf("- ERROR - %s\n", err)
+		}
+	}()
+
+	// Load keys replaced by rotate-keys or renew-cert when we're asked to.
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			reloadKeys(server)
+		}
+	}()
+
+	// Legacy clients are served alongside the hangmango protocol on their own port.
+	if *flagLegacyPort != 0 {
+		listener, err := net.Listen("tcp", fmt.Sprintf(":%d", *flagLegacyPort))
 		if err != nil {
-			log.Printf("- ERROR - Error accepting connection from client: %s\n", connection.RemoteAddr().String())
-			log.Println(err)
+			log.Printf("- ERROR - %s\n", err)
+			log.Println("- SERVER - Exiting.")
+			os.Exit(1)
 		}
+		log.Println("- LEGACY - Serving the line protocol without encryption")
+		go func() {
+			if err := server.ServeLegacy(listener); err != hangmango.ErrServerClosed {
+				log.Printf("- ERROR - %s\n", err)
+			}
+		}()
+	}
 
-		client := &client{socket: connection, data: make(chan []byte), guid: fmt.Sprintf("%d", time.Now().Unix())}
-		manager.register <- client
-		go manager.receiveData(client)
-		go manager.sendData(client)
+	log.Println("- Starting server...")
+	err = server.ListenAndServe()
+	if err != hangmango.ErrServerClosed {
+		log.Printf("- ERROR - %s\n", err)
+		log.Println("- SERVER - Exiting.")
+		os.Exit(1)
 	}
+	log.Println("- SERVER - Exiting.")
 }
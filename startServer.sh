@@ -9,8 +9,15 @@ function control_c {
 trap control_c SIGINT
 trap control_c SIGTERM
 
-echo -e "$(timestamp) - BASH - Copying hangmango.crt from server to client..."
+# Names clients use to reach this server, defaults to loopback only.
+HOSTNAMES=${2:-localhost,127.0.0.1,::1}
+
+echo -e "$(timestamp) - BASH - Generating the hangmango CA and server certificate if required..."
+./app/hangmanserver init-certs -hostnames="$HOSTNAMES" || exit 1
+
+echo -e "$(timestamp) - BASH - Copying hangmango.crt and hangmango-ca.crt from server to client..."
 cp ./app/server/hangmango.crt ./app/client/hangmango.crt || echo -e "$(timestamp) - BASH - Failed to copy hangmango.crt - Ensure that the hangmango server has been built first."
+cp ./app/server/hangmango-ca.crt ./app/client/hangmango-ca.crt || echo -e "$(timestamp) - BASH - Failed to copy hangmango-ca.crt - Ensure that the hangmango server has been built first."
 
-./app/hangmanserver -lport=$1 -wordlist="./app/wordlist.txt"
+./app/hangmanserver -lport=$1 -wordlist="./app/wordlist.txt" -hostnames="$HOSTNAMES"
 